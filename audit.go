@@ -0,0 +1,27 @@
+package main
+
+// AuditToken is a token from ShellSplitAudit.
+type AuditToken struct {
+	Token
+	// Decoded reports whether escape processing changed the token, i.e. its value went through
+	// escape sequences rather than being typed literally.
+	Decoded bool
+}
+
+// ShellSplitAudit splits s on whitespace with escape decoding and reports, per token, whether it
+// was quoted and whether decoding changed it, so reviewers can focus on the tokens that did not
+// arrive literally.
+func ShellSplitAudit(s string) ([]AuditToken, error) {
+	var decoded []bool
+	tokens, err := splitTokens(s, SplitOptions{DecodeEscapes: true}, func(sc *scanner) {
+		decoded = append(decoded, sc.decoded)
+	})
+	if err != nil || tokens == nil {
+		return nil, err
+	}
+	audit := make([]AuditToken, len(tokens))
+	for i, t := range tokens {
+		audit[i] = AuditToken{Token: t, Decoded: decoded[i]}
+	}
+	return audit, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestShellSplitAudit(t *testing.T) {
+	tokens, err := ShellSplitAudit(`"a\tb" abc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("got %d tokens, want 2: %+v", len(tokens), tokens)
+	}
+	if tok := tokens[0]; tok.Value != "a\tb" || !tok.Decoded || !tok.Quoted || tok.EndRune != 6 || len(tok.Segments) != 1 {
+		t.Errorf(`"a\tb": got %+v, want a decoded, quoted token ending at rune 6 with one segment`, tok)
+	}
+	if tok := tokens[1]; tok.Value != "abc" || tok.Decoded || tok.Quoted || tok.LeadingSep != " " {
+		t.Errorf("abc: got %+v, want a literal, unquoted token after a space", tok)
+	}
+}
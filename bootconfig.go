@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+func ParseBootConfig(input string) ([]string, error) {
+	return ParseBootConfigWithOptions(input, KeyValueOptions{})
+}
+
+// ParseBootConfigWithOptions is ParseBootConfig with the optional behaviors selected by opts.
+func ParseBootConfigWithOptions(input string, opts KeyValueOptions) ([]string, error) {
+	// $ cat /proc/bootconfig
+	// CabCmdBranches = "test\x20me", "here", "ok"
+	// CabCmdDryRun = "1"
+	// CabServer = "10.10.1.234"
+	lines, err := parseKeyValueLines(input, "=", bootConfigValueDelim, opts)
+	if err != nil {
+		return nil, WrapTraceableErrorf(err, "failed to parse /proc/bootconfig output")
+	}
+	cmds := make([]string, 0, len(lines))
+	for _, kv := range lines {
+		cmds = append(cmds, fmt.Sprintf("%s=%s", kv.key, strings.Join(kv.fields, ",")))
+	}
+	return cmds, nil
+}
+
+// ParseBootConfigRaw parses /proc/bootconfig output like ParseBootConfig but keeps each value exactly
+// as written after its '=', quotes and commas intact, with only the surrounding whitespace trimmed, for
+// consumers that re-emit the bootconfig. Values must still be well formed (no quote left open).
+func ParseBootConfigRaw(input string) ([]KeyValue, error) {
+	lines, err := parseKeyValueLines(input, "=", bootConfigValueDelim, KeyValueOptions{})
+	if err != nil {
+		return nil, WrapTraceableErrorf(err, "failed to parse /proc/bootconfig output")
+	}
+	kvs := make([]KeyValue, 0, len(lines))
+	for _, kv := range lines {
+		kvs = append(kvs, KeyValue{Key: kv.key, Value: kv.raw})
+	}
+	return kvs, nil
+}
+
+// bootConfigValueDelim splits bootconfig values on whitespace and commas.
+func bootConfigValueDelim(r rune) bool {
+	return unicode.IsSpace(r) || r == ','
+}
+
+// BootConfigToEnv parses /proc/bootconfig output like ParseBootConfig and returns it as KEY=VALUE
+// entries suitable for exec.Cmd.Env. keyTransform, if not nil, maps each bootconfig key to its
+// environment variable name, e.g. kernel.CabIP to CAB_IP. Values need no quoting in an environment
+// entry, but one holding a NUL byte cannot be passed and is reported as an error, as is a transformed
+// key that is empty or holds '=' or NUL.
+func BootConfigToEnv(input string, keyTransform func(string) string) ([]string, error) {
+	lines, err := parseKeyValueLines(input, "=", bootConfigValueDelim, KeyValueOptions{})
+	if err != nil {
+		return nil, WrapTraceableErrorf(err, "failed to parse /proc/bootconfig output")
+	}
+	env := make([]string, 0, len(lines))
+	for _, kv := range lines {
+		key := kv.key
+		if keyTransform != nil {
+			key = keyTransform(key)
+		}
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return nil, WrapTraceableErrorf(nil, "invalid environment variable name %q for bootconfig key %q", key, kv.key)
+		}
+		value := strings.Join(kv.fields, ",")
+		if strings.IndexByte(value, 0) >= 0 {
+			return nil, WrapTraceableErrorf(nil, "bootconfig key %q has a value with a NUL byte", kv.key)
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, nil
+}
+
+// ParseKernelCmdline parses a kernel command line, as read from /proc/cmdline: it is split like
+// ShellSplit and each token is cut at its first '=' into a key and a value, so quoted values keep their
+// spaces (`init="/bin/sh -c foo"` is init and "/bin/sh -c foo"). A bare flag such as ro has an empty
+// value. Keys are in command line order, and may repeat.
+func ParseKernelCmdline(input string) ([]KeyValue, error) {
+	tokens, err := ShellSplit(input)
+	if err != nil {
+		return nil, WrapTraceableErrorf(err, "failed to parse kernel command line")
+	}
+	kvs := make([]KeyValue, 0, len(tokens))
+	for _, t := range tokens {
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		kvs = append(kvs, KeyValue{Key: kv[0], Value: kv[1]})
+	}
+	return kvs, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBootConfigToEnv(t *testing.T) {
+	toEnv := func(key string) string { return strings.ToUpper(strings.ReplaceAll(key, ".", "_")) }
+	got, err := BootConfigToEnv("kernel.CabIP = \"10.0.0.1\"\nCabCmdBranches = \"a\", \"b\"\n", toEnv)
+	if want := []string{"KERNEL_CABIP=10.0.0.1", "CABCMDBRANCHES=a,b"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("BootConfigToEnv = %q, %v; want %q", got, err, want)
+	}
+	for _, tc := range []struct {
+		in           string
+		keyTransform func(string) string
+	}{
+		{"a = \"x\x00y\"\n", nil},                            // a NUL byte in the value
+		{"a = 1\n", func(string) string { return "A=B" }},    // '=' in the name
+		{"a = 1\n", func(string) string { return "A\x00B" }}, // NUL in the name
+		{"a = 1\n", func(string) string { return "" }},       // no name
+	} {
+		if got, err := BootConfigToEnv(tc.in, tc.keyTransform); err == nil {
+			t.Errorf("BootConfigToEnv(%q) = %q; want an error", tc.in, got)
+		}
+	}
+}
+
+func TestParseBootConfigMultilineValue(t *testing.T) {
+	got, err := ParseBootConfig("a = \"x\ny\"\nb = 1\n")
+	if want := []string{"a=x\ny", "b=1"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBootConfig = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestParseBootConfigRaw(t *testing.T) {
+	got, err := ParseBootConfigRaw("CabCmdBranches = \"test\\x20me\", \"here\",  \"ok\"  \nCabServer = 1\n")
+	want := []KeyValue{{"CabCmdBranches", `"test\x20me", "here",  "ok"`}, {"CabServer", "1"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBootConfigRaw = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestParseKernelCmdline(t *testing.T) {
+	got, err := ParseKernelCmdline(`ro quiet root=/dev/sda1 init="/bin/sh -c foo"`)
+	want := []KeyValue{{"ro", ""}, {"quiet", ""}, {"root", "/dev/sda1"}, {"init", "/bin/sh -c foo"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseKernelCmdline = %q, %v; want %q", got, err, want)
+	}
+}
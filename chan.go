@@ -0,0 +1,38 @@
+package main
+
+import "context"
+
+// ShellSplitChan splits s like ShellSplitEx in a goroutine of its own, sending the tokens on the first
+// channel as they are found, for select-based pipelines. Both channels are closed once splitting ends;
+// the error channel, which is buffered, first receives the error that ended it, if any. Cancelling ctx
+// stops the goroutine even if the tokens are no longer received, and ends the split with ctx.Err().
+func ShellSplitChan(ctx context.Context, s string, splitFn func(rune) bool) (<-chan string, <-chan error) {
+	tokens, errc := make(chan string), make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(tokens)
+		sc := newScanner([]byte(s), &SplitOptions{SplitFn: splitFn})
+		for {
+			start, ok, err := sc.next()
+			if err != nil {
+				errc <- err
+				return
+			}
+			if !ok {
+				return
+			}
+			value, err := sc.value(start)
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case tokens <- value:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return tokens, errc
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestShellSplitChan(t *testing.T) {
+	tokens, errc := ShellSplitChan(context.Background(), `a "b c" d`, nil)
+	var got []string
+	for tok := range tokens {
+		got = append(got, tok)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tokens = %q, want %q", got, want)
+	}
+	tokens, errc = ShellSplitChan(context.Background(), `a "b`, nil)
+	for range tokens {
+	}
+	if err := <-errc; err == nil {
+		t.Error(`ShellSplitChan("a \"b") sent no error`)
+	}
+}
+
+func TestShellSplitChanCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	tokens, errc := ShellSplitChan(ctx, "a b c d e f", nil)
+	if tok := <-tokens; tok != "a" {
+		t.Fatalf("first token = %q, want %q", tok, "a")
+	}
+	cancel() // and receive no more tokens
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+	// the goroutine is gone once it has closed both channels and returned
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage:
+  shellsplit split [string]     print the tokens of string, one per line
+  shellsplit bootconfig [file]  print the key=value lines of a /proc/bootconfig file
+The input is read from stdin if the string or file is not given.`
+
+// run runs the shellsplit command with the arguments args (not including the program name).
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return WrapTraceableErrorf(nil, "wrong number of arguments\n%s", usage)
+	}
+	var lines []string
+	var err error
+	switch args[0] {
+	case "split":
+		var s string
+		if s, err = cliInput(args, stdin, false); err == nil {
+			lines, err = ShellSplit(s)
+		}
+	case "bootconfig":
+		var s string
+		if s, err = cliInput(args, stdin, true); err == nil {
+			lines, err = ParseBootConfig(s)
+		}
+	default:
+		return WrapTraceableErrorf(nil, "unknown command %q\n%s", args[0], usage)
+	}
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(stdout, l); err != nil {
+			return WrapTraceableErrorf(err, "failed to write output")
+		}
+	}
+	return nil
+}
+
+// cliInput returns the input of the command line args: its argument, read as a file name if file is
+// true, or all of stdin if there is none.
+func cliInput(args []string, stdin io.Reader, file bool) (string, error) {
+	switch {
+	case len(args) == 2 && !file:
+		return args[1], nil
+	case len(args) == 2:
+		b, err := os.ReadFile(args[1])
+		if err != nil {
+			return "", WrapTraceableErrorf(err, "failed to read %s", args[1])
+		}
+		return string(b), nil
+	}
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", WrapTraceableErrorf(err, "failed to read stdin")
+	}
+	return string(b), nil
+}
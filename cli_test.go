@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const bootconfig = `CabCmdBranches = "test\x20me", "here", "ok"
+CabServer = "10.10.1.234"
+`
+
+func TestRunSplit(t *testing.T) {
+	for _, tc := range []struct {
+		args  []string
+		stdin string
+	}{
+		{[]string{"split", `a "b c" d`}, ""},
+		{[]string{"split"}, `a "b c" d`},
+	} {
+		var stdout bytes.Buffer
+		if err := run(tc.args, strings.NewReader(tc.stdin), &stdout); err != nil {
+			t.Fatalf("run(%q): %v", tc.args, err)
+		}
+		if got, want := stdout.String(), "a\nb c\nd\n"; got != want {
+			t.Errorf("run(%q) printed %q, want %q", tc.args, got, want)
+		}
+	}
+}
+
+func TestRunBootConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bootconfig")
+	if err := os.WriteFile(file, []byte(bootconfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := "CabCmdBranches=test\\x20me,here,ok\nCabServer=10.10.1.234\n"
+	for _, tc := range []struct {
+		args  []string
+		stdin string
+	}{
+		{[]string{"bootconfig", file}, ""},
+		{[]string{"bootconfig"}, bootconfig},
+	} {
+		var stdout bytes.Buffer
+		if err := run(tc.args, strings.NewReader(tc.stdin), &stdout); err != nil {
+			t.Fatalf("run(%q): %v", tc.args, err)
+		}
+		if got := stdout.String(); got != want {
+			t.Errorf("run(%q) printed %q, want %q", tc.args, got, want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, args := range [][]string{nil, {"frobnicate"}, {"split", "a", "b"}, {"split", `"open`}} {
+		if err := run(args, strings.NewReader(""), &bytes.Buffer{}); err == nil {
+			t.Errorf("run(%q) succeeded; want an error", args)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitProgramAndArgs splits off the program name of the command line s: prog is its first token,
+// decoded as ShellSplit would, and rest is the remainder of s exactly as written, minus the whitespace
+// between the two, so it can be executed verbatim or split later. Both are empty if s holds no token.
+func SplitProgramAndArgs(s string) (prog string, rest string, err error) {
+	return SplitFirst(s, unicode.IsSpace)
+}
+
+// SplitFirst splits off the first token of s, split on splitFn (unicode.IsSpace if nil) like ShellSplitEx:
+// first is that token, decoded, and rest is the remainder of s exactly as written, minus the split runes
+// after first, so `run   a "b c"` is "run" and `a "b c"`. Both are empty if s holds no token.
+func SplitFirst(s string, splitFn func(rune) bool) (first string, rest string, err error) {
+	sc := newScanner([]byte(s), &SplitOptions{SplitFn: splitFn})
+	if _, ok, err := sc.next(); err != nil || !ok {
+		return "", "", err
+	}
+	first = string(sc.tok)
+	if err := sc.skipSplitCh(); err != nil { // a quote is never skipped, even if splitFn matches it
+		return "", "", err
+	}
+	return first, s[sc.idx:], nil
+}
+
+// containerCommandOptions are the rules SplitContainerCommand splits with.
+var containerCommandOptions = SplitOptions{DecodeEscapes: true}
+
+// SplitContainerCommand splits a command stored as a single string, as found in Docker and Kubernetes
+// specs, into the argv array an entrypoint receives: whitespace separates arguments, single and double
+// quotes group them, and backslashes escape (`sh -c "echo hello"` is "sh", "-c" and "echo hello").
+// It is ShellSplitWithOptions with a preset; no variable expansion or globbing is performed.
+func SplitContainerCommand(s string) ([]string, error) {
+	return ShellSplitWithOptions(s, containerCommandOptions)
+}
+
+// SplitScript splits the contents of a script, peeling off its shebang line first: if s starts with
+// "#!", shebang is that first line as written (without its newline) and only the rest of s is split
+// into tokens. Otherwise shebang is empty and all of s is split, like ShellSplit.
+func SplitScript(s string) (shebang string, tokens []string, err error) {
+	if strings.HasPrefix(s, "#!") {
+		shebang, s = s, ""
+		if i := strings.IndexByte(shebang, '\n'); i >= 0 {
+			shebang, s = shebang[:i], shebang[i+1:]
+		}
+		shebang = strings.TrimSuffix(shebang, "\r")
+	}
+	if tokens, err = ShellSplit(s); err != nil {
+		return "", nil, WrapTraceableErrorf(err, "failed to split script")
+	}
+	return shebang, tokens, nil
+}
+
+// SplitCommandWithEnv splits the command line s like ShellSplit, separating the NAME=value assignments
+// before the command, as in `FOO=1 BAR="a b" run x`, into env ({FOO: 1, BAR: a b}) from the command
+// tokens in cmd (run and x). Only tokens before the first one that is not an assignment count, and the
+// name must be an unquoted identifier, so `"FOO=1"` or `1X=2` starts the command.
+func SplitCommandWithEnv(s string) (env map[string]string, cmd []string, err error) {
+	tokens, err := ShellSplitTokens(s, SplitOptions{})
+	if err != nil {
+		return nil, nil, WrapTraceableErrorf(err, "failed to split command %q", s)
+	}
+	env = make(map[string]string)
+	i := 0
+	for ; i < len(tokens); i++ {
+		name, _, ok := strings.Cut(tokens[i].Raw, "=")
+		if !ok || !IsIdentifier(name) {
+			break
+		}
+		env[name] = tokens[i].Value[len(name)+1:]
+	}
+	for _, t := range tokens[i:] {
+		cmd = append(cmd, t.Value)
+	}
+	return env, cmd, nil
+}
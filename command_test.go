@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFirst(t *testing.T) {
+	for _, tc := range []struct {
+		in          string
+		splitFn     func(rune) bool
+		first, rest string
+	}{
+		{"run   a b c", nil, "run", "a b c"},
+		{`run   a "b c"`, nil, "run", `a "b c"`},
+		{"  run", nil, "run", ""},
+		{"", nil, "", ""},
+		{`a "b c"`, RuneSet(` "`), "a", `"b c"`}, // quotes take precedence over splitFn
+		{`"a b"  c`, nil, "a b", "c"},
+	} {
+		first, rest, err := SplitFirst(tc.in, tc.splitFn)
+		if err != nil || first != tc.first || rest != tc.rest {
+			t.Errorf("SplitFirst(%q) = %q, %q, %v; want %q, %q", tc.in, first, rest, err, tc.first, tc.rest)
+		}
+	}
+	if _, _, err := SplitFirst(`"open`, nil); err == nil {
+		t.Error(`SplitFirst("\"open") succeeded; want an error`)
+	}
+}
+
+func TestSplitProgramAndArgs(t *testing.T) {
+	for _, tc := range []struct{ in, prog, rest string }{
+		{`/bin/ls "a b" c`, "/bin/ls", `"a b" c`},
+		{`  "/my prog"   x  `, "/my prog", "x  "}, // the rest is kept as written
+		{"", "", ""},
+	} {
+		prog, rest, err := SplitProgramAndArgs(tc.in)
+		if err != nil || prog != tc.prog || rest != tc.rest {
+			t.Errorf("SplitProgramAndArgs(%q) = %q, %q, %v; want %q, %q", tc.in, prog, rest, err, tc.prog, tc.rest)
+		}
+	}
+}
+
+func TestSplitContainerCommand(t *testing.T) {
+	got, err := SplitContainerCommand(`sh -c "echo hello"`)
+	if want := []string{"sh", "-c", "echo hello"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf(`SplitContainerCommand("sh -c \"echo hello\"") = %q, %v; want %q`, got, err, want)
+	}
+}
+
+func TestSplitScript(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		shebang string
+		tokens  []string
+	}{
+		{"#!/bin/sh -e\necho \"a b\"\n", "#!/bin/sh -e", []string{"echo", "a b"}},
+		{"#!/bin/sh\r\nx", "#!/bin/sh", []string{"x"}},
+		{"#!/bin/sh", "#!/bin/sh", nil},
+		{"echo x", "", []string{"echo", "x"}},
+	} {
+		shebang, tokens, err := SplitScript(tc.in)
+		if err != nil || shebang != tc.shebang || !reflect.DeepEqual(tokens, tc.tokens) {
+			t.Errorf("SplitScript(%q) = %q, %q, %v; want %q, %q", tc.in, shebang, tokens, err, tc.shebang, tc.tokens)
+		}
+	}
+}
+
+func TestSplitCommandWithEnv(t *testing.T) {
+	env, cmd, err := SplitCommandWithEnv(`FOO=1 BAR="a b" run x=2 y`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"FOO": "1", "BAR": "a b"}; !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %q, want %q", env, want)
+	}
+	if want := []string{"run", "x=2", "y"}; !reflect.DeepEqual(cmd, want) { // only assignments before the command
+		t.Errorf("cmd = %q, want %q", cmd, want)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EncodingError reports an invalid UTF-8 encoding in the input.
+type EncodingError struct {
+	Offset  int    // byte index of the invalid byte
+	Byte    byte   // the invalid byte
+	context string // the input before Offset
+}
+
+func (e *EncodingError) Error() string {
+	return fmt.Sprintf("invalid Unicode encoding char '%s' at index %d (%s)", SafeString(string([]byte{e.Byte})), e.Offset,
+		e.context)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e *EncodingError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		errorJSON
+		Byte byte `json:"byte"`
+	}{errorJSON{"encoding", e.Offset, e.Error()}, e.Byte})
+}
+
+// UnterminatedQuoteError reports a quote that is never closed, including a quote that makes up the
+// whole input (Offset 0).
+//
+// ASCII quotes have no direction: outside a quoted segment, every quote opens one. A stray quote, such
+// as the one in `a b" c` meant to close nothing, is therefore reported as an UnterminatedQuoteError at
+// its own offset (3 here) rather than as an unexpected closing quote. With SmartQuotes, a closing curly
+// quote met outside a quoted segment is an ordinary rune.
+type UnterminatedQuoteError struct {
+	Offset int  // byte index of the opening quote
+	Quote  rune // the opening quote
+}
+
+func (e *UnterminatedQuoteError) Error() string {
+	switch e.Quote {
+	case '{':
+		return "no matching close brace found"
+	case '(':
+		return "no matching close parenthesis found"
+	}
+	return fmt.Sprintf("no end matching quote (%c) found", e.Quote)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e *UnterminatedQuoteError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		errorJSON
+		Quote string `json:"quote"`
+	}{errorJSON{"unterminated_quote", e.Offset, e.Error()}, string(e.Quote)})
+}
+
+// UnterminatedCommentError reports a block comment (see SplitOptions.BlockComments) that is never closed.
+type UnterminatedCommentError struct {
+	Offset int // byte index of the opening /*
+}
+
+func (e *UnterminatedCommentError) Error() string {
+	return fmt.Sprintf("no end of the block comment starting at index %d found", e.Offset)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e *UnterminatedCommentError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(errorJSON{"unterminated_comment", e.Offset, e.Error()})
+}
+
+// QuoteSpanError reports a quoted segment longer than SplitOptions.MaxQuoteSpan.
+type QuoteSpanError struct {
+	Offset  int  // byte index of the opening quote
+	Quote   rune // the opening quote
+	MaxSpan int  // the limit that was exceeded
+}
+
+func (e *QuoteSpanError) Error() string {
+	return fmt.Sprintf("quoted segment opened by (%c) at index %d exceeds %d runes", e.Quote, e.Offset, e.MaxSpan)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e *QuoteSpanError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		errorJSON
+		Quote   string `json:"quote"`
+		MaxSpan int    `json:"max_span"`
+	}{errorJSON{"quote_span", e.Offset, e.Error()}, string(e.Quote), e.MaxSpan})
+}
+
+// EscapeError reports a malformed escape sequence.
+type EscapeError struct {
+	Offset      int    // byte index of the backslash
+	TokenOffset int    // byte index of the backslash in the source text of its token
+	Sequence    string // the malformed sequence
+	Reason      string // what is wrong with it
+}
+
+func (e *EscapeError) Error() string {
+	return fmt.Sprintf("invalid escape sequence %q at index %d (index %d of its token): %s", e.Sequence, e.Offset,
+		e.TokenOffset, e.Reason)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e *EscapeError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		errorJSON
+		TokenOffset int    `json:"token_offset"`
+		Sequence    string `json:"sequence"`
+	}{errorJSON{"escape", e.Offset, e.Error()}, e.TokenOffset, e.Sequence})
+}
+
+// DepthError reports brace quotes or substitutions nested deeper than SplitOptions.MaxDepth.
+type DepthError struct {
+	Offset   int // byte index of the opening rune that is too deep
+	MaxDepth int // the limit that was exceeded
+}
+
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("nesting at index %d exceeds the maximum depth of %d", e.Offset, e.MaxDepth)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e *DepthError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		errorJSON
+		MaxDepth int `json:"max_depth"`
+	}{errorJSON{"depth", e.Offset, e.Error()}, e.MaxDepth})
+}
+
+// errorJSON holds the fields common to the JSON form of every typed error.
+type errorJSON struct {
+	Kind    string `json:"kind"`
+	Offset  int    `json:"offset"`
+	Message string `json:"message"`
+}
+
+// MarshalErrorJSON encodes err as JSON. The errors this package returns wrap the typed errors above, and
+// a wrapping error has no MarshalJSON of its own, so json.Marshal(err) gives {}; MarshalErrorJSON unwraps
+// err to the typed error it holds and encodes that instead. Any other error is encoded with the kind
+// "error", an offset of -1 and its message.
+func MarshalErrorJSON(err error) ([]byte, error) {
+	var oe offsetError
+	if errors.As(err, &oe) {
+		return json.Marshal(oe)
+	}
+	return json.Marshal(errorJSON{"error", -1, err.Error()})
+}
+
+// offsetError is implemented by the errors that record the byte index of the problem in the input.
+type offsetError interface {
+	error
+	errorOffset() int
+	addOffset(n int) // moves the offset by n, for input split out of a larger one
+}
+
+func (e *EncodingError) errorOffset() int            { return e.Offset }
+func (e *UnterminatedQuoteError) errorOffset() int   { return e.Offset }
+func (e *UnterminatedCommentError) errorOffset() int { return e.Offset }
+func (e *QuoteSpanError) errorOffset() int           { return e.Offset }
+func (e *EscapeError) errorOffset() int              { return e.Offset }
+func (e *DepthError) errorOffset() int               { return e.Offset }
+
+func (e *EncodingError) addOffset(n int)            { e.Offset += n }
+func (e *UnterminatedQuoteError) addOffset(n int)   { e.Offset += n }
+func (e *UnterminatedCommentError) addOffset(n int) { e.Offset += n }
+func (e *QuoteSpanError) addOffset(n int)           { e.Offset += n }
+func (e *EscapeError) addOffset(n int)              { e.Offset += n }
+func (e *DepthError) addOffset(n int)               { e.Offset += n }
+
+// rebaseError moves the offset err records, if any, by n: from one into a part of the input starting at
+// index n to one into the whole input.
+func rebaseError(err error, n int) {
+	var oe offsetError
+	if errors.As(err, &oe) {
+		oe.addOffset(n)
+	}
+}
+
+// FormatError renders err like a compiler diagnostic: the error message, then the line of input
+// holding the offending byte, then a caret under it. Errors without a recorded offset are returned
+// as err.Error().
+func FormatError(err error, input string) string {
+	var oe offsetError
+	if !errors.As(err, &oe) {
+		return err.Error()
+	}
+	offset := oe.errorOffset()
+	if offset < 0 || offset > len(input) {
+		return err.Error()
+	}
+	start := strings.LastIndexByte(input[:offset], '\n') + 1
+	end := strings.IndexByte(input[offset:], '\n')
+	if end < 0 {
+		end = len(input)
+	} else {
+		end += offset
+	}
+	var sb strings.Builder
+	sb.WriteString(err.Error())
+	sb.WriteByte('\n')
+	sb.WriteString(input[start:end])
+	sb.WriteByte('\n')
+	for _, r := range input[start:offset] {
+		if r == '\t' { // keep tabs so the caret lines up however wide they are shown
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	sb.WriteByte('^')
+	return sb.String()
+}
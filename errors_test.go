@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMarshalErrorJSON(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		opts   SplitOptions
+		kind   string
+		offset int
+	}{
+		{"a \xffb", SplitOptions{}, "encoding", 2},
+		{`a "b`, SplitOptions{}, "unterminated_quote", 2},
+		{`a /* b`, SplitOptions{BlockComments: true}, "unterminated_comment", 2},
+		{`a "bcd"`, SplitOptions{MaxQuoteSpan: 2}, "quote_span", 2},
+		{`a \x2`, SplitOptions{DecodeEscapes: true}, "escape", 2},
+		{`a {{b}}`, SplitOptions{BraceQuotes: true, MaxDepth: 1}, "depth", 3},
+	} {
+		_, err := ShellSplitWithOptions(tc.in, tc.opts)
+		if err == nil {
+			t.Errorf("ShellSplitWithOptions(%q) succeeded; want an error", tc.in)
+			continue
+		}
+		b, err2 := MarshalErrorJSON(err)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		var got errorJSON
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		var oe offsetError
+		errors.As(err, &oe)
+		if got.Kind != tc.kind || got.Offset != tc.offset || got.Message != oe.Error() {
+			t.Errorf("MarshalErrorJSON(error of %q) = %s; want kind %q, offset %d and message %q", tc.in, b,
+				tc.kind, tc.offset, oe.Error())
+		}
+	}
+	b, err := MarshalErrorJSON(errors.New("plain"))
+	if want := `{"kind":"error","offset":-1,"message":"plain"}`; err != nil || string(b) != want {
+		t.Errorf("MarshalErrorJSON(plain error) = %s, %v; want %s", b, err, want)
+	}
+}
+
+func TestFormatErrorCaret(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{`a "b`, "a \"b\n  ^"},
+		{"a\tb \"c", "a\tb \"c\n \t  ^"}, // tabs are kept
+		{"é日 \"c", "é日 \"c\n   ^"},       // one space per rune, not per byte
+		{"x\n\t\"y", "\t\"y\n\t^"},       // only the line holding the error
+	} {
+		_, err := ShellSplit(tc.in)
+		if err == nil {
+			t.Fatalf("ShellSplit(%q) succeeded; want an error", tc.in)
+		}
+		if got := FormatError(err, tc.in); !strings.HasSuffix(got, "\n"+tc.want) {
+			t.Errorf("FormatError(%q) = %q, want it to end with %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestEscapeErrorSequence(t *testing.T) {
+	_, err := ShellSplitWithOptions(`ab "c\x2"`, SplitOptions{DecodeEscapes: true})
+	var ee *EscapeError
+	if !errors.As(err, &ee) {
+		t.Fatalf("error = %v, want an EscapeError", err)
+	}
+	if ee.Sequence != `\x2` || ee.Offset != 5 || ee.TokenOffset != 2 {
+		t.Errorf("EscapeError = %+v; want the sequence \\x2 at 5, index 2 of its token", ee)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+// ExpandShortFlags expands combined getopt-style short flags: a token made of '-' and two or more ASCII
+// letters, like -abc, becomes -a -b -c. Expansion stops at the first '=' or other non-letter, which stays
+// attached to the last flag, so -abc=x is -a -b -c=x while -o=value, with a single letter, is left intact.
+// Tokens after a "--" are never expanded. fields is not modified.
+func ExpandShortFlags(fields []string) []string {
+	expanded := make([]string, 0, len(fields))
+	for i, f := range fields {
+		if f == "--" {
+			return append(expanded, fields[i:]...)
+		}
+		n := 0 // letters after the '-'
+		for n+1 < len(f) && isASCIILetter(f[n+1]) {
+			n++
+		}
+		if len(f) < 3 || f[0] != '-' || n < 2 {
+			expanded = append(expanded, f)
+			continue
+		}
+		for j := 1; j < n; j++ {
+			expanded = append(expanded, "-"+f[j:j+1])
+		}
+		expanded = append(expanded, "-"+f[n:])
+	}
+	return expanded
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandShortFlags(t *testing.T) {
+	in := []string{"-abc", "-o=value", "-abc=x", "-v", "--", "-xy"}
+	want := []string{"-a", "-b", "-c", "-o=value", "-a", "-b", "-c=x", "-v", "--", "-xy"}
+	if got := ExpandShortFlags(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandShortFlags(%q) = %q, want %q", in, got, want)
+	}
+	if in[0] != "-abc" {
+		t.Errorf("ExpandShortFlags modified its input: %q", in)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+// JoinQuotedFragments rejoins fields that were split inside a quoted segment, as a recovery utility for
+// malformed input: a field left with an unmatched quote is joined, with single spaces, to the fields
+// after it until the quote is closed, so `a"b` and `c"` become `a"b c"`. A quote that is never closed
+// takes the remaining fields with it. Fields are not otherwise changed; quotes are kept.
+func JoinQuotedFragments(fields []string) []string {
+	if fields == nil {
+		return nil
+	}
+	joined := make([]string, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		for openQuote(f, "") && i+1 < len(fields) {
+			i++
+			f += " " + fields[i]
+		}
+		joined = append(joined, f)
+	}
+	return joined
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJoinQuotedFragments(t *testing.T) {
+	in := []string{"x", `a"b`, `c"`, "d", `'e`, "f"}
+	want := []string{"x", `a"b c"`, "d", `'e f`} // a quote never closed takes the rest
+	if got := JoinQuotedFragments(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("JoinQuotedFragments(%q) = %q, want %q", in, got, want)
+	}
+}
@@ -1,3 +1,3 @@
-module main
+module github.com/hclihn/ShellSplit
 
-go 1.19
+go 1.23
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// IncrementalSplitter splits input that arrives in chunks, such as command bytes read from a network
+// stream. Feed returns the tokens each chunk completes; a token is complete once a split rune follows
+// it, so the tail of the input is only returned by Flush. Open quotes, escapes and multi-byte runes
+// may straddle chunks. An IncrementalSplitter is not safe for concurrent use.
+type IncrementalSplitter struct {
+	opts SplitOptions
+	buf  []byte // input not turned into tokens yet
+
+	state tokenState // scanner state at the start of buf
+}
+
+// NewIncrementalSplitter returns an IncrementalSplitter that splits as configured by opts.
+func NewIncrementalSplitter(opts SplitOptions) *IncrementalSplitter {
+	return &IncrementalSplitter{opts: opts}
+}
+
+// Feed adds b to the input and returns the tokens it completed. On error the pending input is
+// discarded, and the offsets in the error are relative to the start of that pending input.
+func (is *IncrementalSplitter) Feed(b []byte) ([]string, error) {
+	is.buf = append(is.buf, b...)
+	return is.scan(false)
+}
+
+// Flush ends the input and returns the tokens still pending. The IncrementalSplitter can then be
+// fed a new input.
+func (is *IncrementalSplitter) Flush() ([]string, error) {
+	tokens, err := is.scan(true)
+	is.reset()
+	return tokens, err
+}
+
+func (is *IncrementalSplitter) reset() {
+	is.buf = is.buf[:0]
+	is.state = tokenState{}
+}
+
+// keep drops the input before index mark, which has all been turned into tokens.
+func (is *IncrementalSplitter) keep(mark int, state tokenState) {
+	is.buf = is.buf[:copy(is.buf, is.buf[mark:])]
+	is.state = state
+}
+
+func (is *IncrementalSplitter) scan(final bool) ([]string, error) {
+	limit := len(is.buf)
+	if !final { // leave a partial rune at the end for the next chunk to complete
+		for i := 1; i < utf8.UTFMax && i <= len(is.buf); i++ {
+			if start := len(is.buf) - i; utf8.RuneStart(is.buf[start]) {
+				if !utf8.FullRune(is.buf[start:]) {
+					limit = start
+				}
+				break
+			}
+		}
+	}
+	opts := is.opts
+	if !final { // a quote still open may be closed by the next chunk, so it is only taken literally by Flush
+		opts.LenientQuotes = false
+	}
+	sc := newScanner(is.buf[:limit], &opts)
+	sc.tokenState = is.state
+	var tokens []string
+	for {
+		mark, state := sc.idx, sc.tokenState
+		start, ok, err := sc.next()
+		if err == nil && ok && !final && sc.idx == limit { // more input may extend the token
+			is.keep(mark, state)
+			return tokens, nil
+		}
+		if err != nil {
+			if !final && needsMoreInput(err, limit) {
+				is.keep(mark, state)
+				return tokens, nil
+			}
+			is.reset()
+			return tokens, WrapTraceableErrorf(err, "failed to split fed input")
+		}
+		if !ok {
+			is.keep(sc.idx, sc.tokenState)
+			return tokens, nil
+		}
+		value, err := sc.value(start)
+		if err != nil {
+			is.reset()
+			return tokens, err
+		}
+		tokens = append(tokens, value)
+	}
+}
+
+// needsMoreInput reports whether err comes from input of length l being cut short rather than malformed.
+func needsMoreInput(err error, l int) bool {
+	var uqe *UnterminatedQuoteError
+	var uce *UnterminatedCommentError
+	var ee *EscapeError
+	switch {
+	case errors.As(err, &uqe), errors.As(err, &uce):
+		return true
+	case errors.As(err, &ee):
+		return ee.Offset+len(ee.Sequence) == l
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIncrementalSplitter(t *testing.T) {
+	for _, lenient := range []bool{false, true} {
+		is := NewIncrementalSplitter(SplitOptions{LenientQuotes: lenient})
+		var got [][]string
+		for _, chunk := range []string{`a "b `, `c" d`} {
+			tokens, err := is.Feed([]byte(chunk))
+			if err != nil {
+				t.Fatalf("LenientQuotes=%v: Feed(%q): %v", lenient, chunk, err)
+			}
+			got = append(got, tokens)
+		}
+		tokens, err := is.Flush()
+		if err != nil {
+			t.Fatalf("LenientQuotes=%v: Flush: %v", lenient, err)
+		}
+		got = append(got, tokens)
+		if want := [][]string{{"a"}, {"b c"}, {"d"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("LenientQuotes=%v: got %q, want %q", lenient, got, want)
+		}
+	}
+}
+
+func TestIncrementalSplitterSplitsRunes(t *testing.T) {
+	is := NewIncrementalSplitter(SplitOptions{})
+	b := []byte("日本 語")
+	tokens, err := is.Feed(b[:2])
+	if err != nil || tokens != nil {
+		t.Fatalf("Feed of a partial rune = %q, %v; want nothing", tokens, err)
+	}
+	if tokens, err = is.Feed(b[2:]); err != nil || !reflect.DeepEqual(tokens, []string{"日本"}) {
+		t.Errorf("Feed = %q, %v; want [日本]", tokens, err)
+	}
+	if tokens, err = is.Flush(); err != nil || !reflect.DeepEqual(tokens, []string{"語"}) {
+		t.Errorf("Flush = %q, %v; want [語]", tokens, err)
+	}
+}
+
+func TestIncrementalSplitterFlushOpenQuote(t *testing.T) {
+	is := NewIncrementalSplitter(SplitOptions{})
+	if _, err := is.Feed([]byte(`a "b`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := is.Flush(); err == nil {
+		t.Error("Flush of an open quote succeeded; want an error")
+	}
+	is = NewIncrementalSplitter(SplitOptions{LenientQuotes: true})
+	if tokens, err := is.Feed([]byte(`a "b`)); err != nil || !reflect.DeepEqual(tokens, []string{"a"}) {
+		t.Fatalf("lenient Feed = %q, %v; want [a]", tokens, err)
+	}
+	if tokens, err := is.Flush(); err != nil || !reflect.DeepEqual(tokens, []string{`"b`}) {
+		t.Errorf(`lenient Flush = %q, %v; want ["b]`, tokens, err)
+	}
+}
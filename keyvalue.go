@@ -0,0 +1,268 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keyValueLine is one parsed "key <sep> values" line, kept in input order.
+type keyValueLine struct {
+	key    string
+	fields []string
+	raw    string // the value as written, outer whitespace trimmed
+}
+
+// KeyValue is a key and its value, as written, from one key/value line.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// KeyValueOptions controls the optional behaviors of ParseKeyValueLinesWithOptions and ParseBootConfigWithOptions.
+type KeyValueOptions struct {
+	// StripComments strips a trailing comment, started by a '#' outside quotes, from each value,
+	// and skips lines that are blank or hold only a comment.
+	StripComments bool
+	// CommentRunes, if set, lists the runes that start a comment with StripComments instead of '#',
+	// e.g. "#;" for INI-style configs. A quoted comment rune is literal.
+	CommentRunes string
+	// Spacing, if not SpacingAny, is the spacing required around the separator; a line not spaced
+	// accordingly is an error giving its line number.
+	Spacing Spacing
+	// KeyCaseFunc, if set, normalizes each key, e.g. with strings.ToLower, before it is stored. Two
+	// different keys normalizing to the same one are an error rather than being merged.
+	KeyCaseFunc func(string) string
+	// IdentifierKeys requires each key to be an identifier path, identifiers (see IsIdentifier) joined
+	// by dots such as kernel.CabIP, to catch typos like kernel..CabIP early.
+	IdentifierKeys bool
+}
+
+// Spacing is the spacing a key/value line must have around its separator.
+type Spacing int
+
+const (
+	SpacingAny    Spacing = iota // any blanks, or none (the default)
+	SpacingTight                 // no blank on either side: key=value
+	SpacingPadded                // a single space on each side: key = value
+)
+
+// spacedAs reports whether key and value, the text before and after the separator, are spaced as s requires.
+func (s Spacing) spacedAs(key, value string) bool {
+	switch s {
+	case SpacingTight:
+		return strings.TrimRightFunc(key, unicode.IsSpace) == key && strings.TrimLeftFunc(value, unicode.IsSpace) == value
+	case SpacingPadded:
+		k, v := strings.TrimSuffix(key, " "), strings.TrimPrefix(value, " ")
+		return k != key && v != value && SpacingTight.spacedAs(k, v)
+	}
+	return true
+}
+
+// comments returns the runes that start a comment, or "" if comments are not stripped.
+func (opts KeyValueOptions) comments() string {
+	switch {
+	case !opts.StripComments:
+		return ""
+	case opts.CommentRunes != "":
+		return opts.CommentRunes
+	}
+	return "#"
+}
+
+// ParseKeyValueLines parses input made of "key <sep> value" lines, such as the output of /proc/bootconfig
+// (sep "=") or colon-separated configs (sep ":"). Each value is shell-split with valueDelim
+// (unicode.IsSpace if nil); the fields of a key that appears on several lines are appended in order.
+func ParseKeyValueLines(input string, sep string, valueDelim func(rune) bool) (map[string][]string, error) {
+	return ParseKeyValueLinesWithOptions(input, sep, valueDelim, KeyValueOptions{})
+}
+
+// ParseKeyValueLinesWithOptions is ParseKeyValueLines with the optional behaviors selected by opts.
+func ParseKeyValueLinesWithOptions(input string, sep string, valueDelim func(rune) bool,
+	opts KeyValueOptions) (map[string][]string, error) {
+	lines, err := parseKeyValueLines(input, sep, valueDelim, opts)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]string, len(lines))
+	for _, kv := range lines {
+		m[kv.key] = append(m[kv.key], kv.fields...)
+	}
+	return m, nil
+}
+
+func parseKeyValueLines(input string, sep string, valueDelim func(rune) bool, opts KeyValueOptions) ([]keyValueLine, error) {
+	if sep == "" {
+		return nil, WrapTraceableErrorf(nil, "failed to parse key/value lines: empty separator")
+	}
+	if valueDelim == nil {
+		valueDelim = unicode.IsSpace
+	}
+	comments := opts.comments()
+	normalized := make(map[string]string) // original key of each normalized key, with KeyCaseFunc
+	lines := make([]keyValueLine, 0)
+	lr := newLineReader(input, comments)
+	for {
+		line, first, ok := lr.next()
+		if !ok {
+			break
+		}
+		if comments != "" {
+			if trimmed := strings.TrimSpace(line); trimmed == "" || startsWithRune(trimmed, comments) {
+				continue
+			}
+		}
+		kv := strings.SplitN(line, sep, 2)
+		if l := len(kv); l != 2 {
+			return nil, WrapTraceableErrorf(nil, "failed to parse line %q: missing %q", line, sep)
+		}
+		if !opts.Spacing.spacedAs(kv[0], kv[1]) {
+			return nil, WrapTraceableErrorf(nil, "failed to parse line %d %q: wrong spacing around %q", first, line, sep)
+		}
+		key := strings.TrimSpace(kv[0])
+		if !isConfigKey(key) {
+			return nil, WrapTraceableErrorf(nil,
+				"failed to parse line %q: invalid key %q (only letters, digits, '.', '_' and '-' are allowed)",
+				line, key)
+		}
+		if opts.IdentifierKeys && !isIdentifierPath(key) {
+			return nil, WrapTraceableErrorf(nil, "failed to parse line %d %q: key %q is not a dot-separated identifier path",
+				first, line, key)
+		}
+		if opts.KeyCaseFunc != nil {
+			nk := opts.KeyCaseFunc(key)
+			if orig, ok := normalized[nk]; ok && orig != key {
+				return nil, WrapTraceableErrorf(nil, "failed to parse line %d %q: key %q collides with key %q (both are %q)",
+					first, line, key, orig, nk)
+			}
+			normalized[nk] = key
+			key = nk
+		}
+		value := kv[1]
+		if comments != "" {
+			value = stripTrailingComment(value, comments)
+		}
+		fields, err := ShellSplitEx(value, valueDelim)
+		if err != nil {
+			return nil, WrapTraceableErrorf(err, "failed to parse line %q after %q", line, sep)
+		}
+		lines = append(lines, keyValueLine{key: key, fields: fields, raw: strings.TrimSpace(value)})
+	}
+	if err := lr.err(); err != nil {
+		return nil, WrapTraceableErrorf(err, "failed to read key/value lines")
+	}
+	return lines, nil
+}
+
+// stripTrailingComment cuts value at its first comment rune outside quotes.
+func stripTrailingComment(value string, comments string) string {
+	if i, _ := scanQuotes(value, comments); i >= 0 {
+		return value[:i]
+	}
+	return value
+}
+
+// startsWithRune reports whether the first rune of s is one of runes.
+func startsWithRune(s string, runes string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return strings.ContainsRune(runes, r)
+}
+
+// openQuote reports whether line ends inside a quoted segment, ignoring any comment started by one of
+// the runes of comments.
+func openQuote(line string, comments string) bool {
+	_, open := scanQuotes(line, comments)
+	return open
+}
+
+// scanQuotes returns the index of the first rune of comments outside quotes in s, or -1 if there is
+// none, and whether a quote is left open before it (or at the end of s). Outside single quotes a
+// backslash escapes the byte after it, as it does for quotes when splitting.
+func scanQuotes(s string, comments string) (comment int, open bool) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c >= utf8.RuneSelf: // a multi-byte rune, which can be a comment rune too
+			r, n := utf8.DecodeRuneInString(s[i:])
+			if strings.ContainsRune(comments, r) {
+				return i, false
+			}
+			i += n - 1
+		case strings.IndexByte(comments, c) >= 0:
+			return i, false
+		}
+	}
+	return -1, quote != 0
+}
+
+// isConfigKey reports whether key is a non-empty run of letters, digits, '.', '_' and '-'.
+func isConfigKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsIdentifier reports whether token is an identifier: a letter or '_' followed by letters, digits
+// and '_'.
+func IsIdentifier(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, r := range token {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIdentifierPath reports whether key is made of identifiers separated by single dots.
+func isIdentifierPath(key string) bool {
+	for _, part := range strings.Split(key, ".") {
+		if !IsIdentifier(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseNumericToken interprets a token as a decimal or 0x-prefixed hexadecimal integer, with an
+// optional sign. It reports false if tok is not such a number or does not fit in an int64.
+func ParseNumericToken(tok string) (int64, bool) {
+	digits := strings.TrimLeft(tok, "+-")
+	if len(tok)-len(digits) > 1 {
+		return 0, false
+	}
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' && (digits[1] == 'x' || digits[1] == 'X') {
+		base = 16
+		digits = digits[2:]
+	}
+	// ParseInt only allows '_' with base 0, but would take a second sign after the prefix, as in 0x-5
+	if digits == "" || strings.ContainsAny(digits, "_+-") {
+		return 0, false
+	}
+	if tok[0] == '-' {
+		digits = "-" + digits
+	}
+	n, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
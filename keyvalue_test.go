@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNumericToken(t *testing.T) {
+	for _, tc := range []struct {
+		tok  string
+		want int64
+		ok   bool
+	}{
+		{"0x1f", 31, true},
+		{"0X1F", 31, true},
+		{"31", 31, true},
+		{"-31", -31, true},
+		{"+0x1f", 31, true},
+		{"-0x8000000000000000", -1 << 63, true},
+		{"abc", 0, false},
+		{"", 0, false},
+		{"0x", 0, false},
+		{"0x-5", 0, false},
+		{"0x+5", 0, false},
+		{"--5", 0, false},
+		{"1_000", 0, false},
+		{"0x8000000000000000", 0, false},
+	} {
+		if got, ok := ParseNumericToken(tc.tok); got != tc.want || ok != tc.ok {
+			t.Errorf("ParseNumericToken(%q) = %d, %v; want %d, %v", tc.tok, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestIsConfigKey(t *testing.T) {
+	for _, tc := range []struct {
+		key  string
+		want bool
+	}{
+		{"kernel.CabIP", true},
+		{"Cab_Cmd-Branches2", true},
+		{`bad"key`, false},
+		{"bad'key", false},
+		{"", false},
+	} {
+		if got := isConfigKey(tc.key); got != tc.want {
+			t.Errorf("isConfigKey(%q) = %v, want %v", tc.key, got, tc.want)
+		}
+	}
+	if _, err := ParseBootConfig(`bad"key = 1`); err == nil {
+		t.Error(`ParseBootConfig("bad\"key = 1") succeeded; want an error`)
+	}
+}
+
+func TestParseKeyValueLinesColon(t *testing.T) {
+	got, err := ParseKeyValueLines("a: 1 2\nb : \"x y\"\na: 3\n", ":", nil)
+	want := map[string][]string{"a": {"1", "2", "3"}, "b": {"x y"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseKeyValueLines with ':' = %q, %v; want %q", got, err, want)
+	}
+	// ParseBootConfig is the '=' case
+	cmds, err := ParseBootConfig("kernel.CabIP = \"10.0.0.1\"\nCabCmdBranches = \"test\\x20me\", \"here\"\n")
+	wantCmds := []string{"kernel.CabIP=10.0.0.1", `CabCmdBranches=test\x20me,here`}
+	if err != nil || !reflect.DeepEqual(cmds, wantCmds) {
+		t.Errorf("ParseBootConfig = %q, %v; want %q", cmds, err, wantCmds)
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	const in = "CabIP = \"10.0.0.1\" # primary\n# a comment line\n"
+	got, err := ParseKeyValueLinesWithOptions(in, "=", nil, KeyValueOptions{StripComments: true})
+	if want := map[string][]string{"CabIP": {"10.0.0.1"}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("with StripComments = %q, %v; want %q", got, err, want)
+	}
+	got, err = ParseKeyValueLines("CabIP = \"10.0.0.1\" # primary\n", "=", nil)
+	if want := map[string][]string{"CabIP": {"10.0.0.1", "#", "primary"}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("without StripComments = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestCommentRunes(t *testing.T) {
+	const in = "key = value ; comment\nk2 = \"a;b\"\n; a comment line\n"
+	got, err := ParseKeyValueLinesWithOptions(in, "=", nil, KeyValueOptions{StripComments: true, CommentRunes: "#;"})
+	if want := map[string][]string{"key": {"value"}, "k2": {"a;b"}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("with CommentRunes \"#;\" = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestSpacing(t *testing.T) {
+	for _, tc := range []struct {
+		spacing Spacing
+		in      string
+		badLine string // the line reported, or "" if in is compliant
+	}{
+		{SpacingTight, "a=1\nb=2\n", ""},
+		{SpacingTight, "a=1\nb =2\n", "line 2 "},
+		{SpacingPadded, "a = 1\nb = 2\n", ""},
+		{SpacingPadded, "a = 1\nb  = 2\n", "line 2 "},
+		{SpacingPadded, "a=1\n", "line 1 "},
+	} {
+		_, err := ParseKeyValueLinesWithOptions(tc.in, "=", nil, KeyValueOptions{Spacing: tc.spacing})
+		switch {
+		case tc.badLine == "" && err != nil:
+			t.Errorf("Spacing %d, %q: %v", tc.spacing, tc.in, err)
+		case tc.badLine != "" && (err == nil || !strings.Contains(err.Error(), tc.badLine)):
+			t.Errorf("Spacing %d, %q: error = %v, want one about %s", tc.spacing, tc.in, err, tc.badLine)
+		}
+	}
+}
+
+func TestKeyCaseFunc(t *testing.T) {
+	opts := KeyValueOptions{KeyCaseFunc: strings.ToLower}
+	got, err := ParseKeyValueLinesWithOptions("kernel.CabIP = 1\nkernel.CabIP = 2\n", "=", nil, opts)
+	if want := map[string][]string{"kernel.cabip": {"1", "2"}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("with KeyCaseFunc = %q, %v; want %q", got, err, want)
+	}
+	// two keys that are only the same once lowercased collide
+	if _, err := ParseKeyValueLinesWithOptions("kernel.CabIP = 1\nkernel.cabip = 2\n", "=", nil, opts); err == nil {
+		t.Error("kernel.CabIP and kernel.cabip did not collide")
+	}
+}
+
+func TestIdentifierKeys(t *testing.T) {
+	for _, tc := range []struct {
+		token string
+		want  bool
+	}{
+		{"CabIP", true},
+		{"_a1", true},
+		{"kernel.CabIP", false}, // a path, not an identifier
+		{"1a", false},
+		{"a-b", false},
+	} {
+		if got := IsIdentifier(tc.token); got != tc.want {
+			t.Errorf("IsIdentifier(%q) = %v, want %v", tc.token, got, tc.want)
+		}
+	}
+	opts := KeyValueOptions{IdentifierKeys: true}
+	if _, err := ParseKeyValueLinesWithOptions("kernel.CabIP = 1\n", "=", nil, opts); err != nil {
+		t.Errorf("kernel.CabIP with IdentifierKeys: %v", err)
+	}
+	if _, err := ParseKeyValueLinesWithOptions("kernel..Cab = 1\n", "=", nil, opts); err == nil {
+		t.Error("kernel..Cab with IdentifierKeys succeeded; want an error")
+	}
+}
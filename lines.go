@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"iter"
+	"strings"
+)
+
+// SplitLinesQuoteAware splits s into logical lines: it splits on newlines that are not inside quotes,
+// so a quoted value may span several physical lines. Lines are returned as written, quotes intact;
+// empty lines are dropped.
+func SplitLinesQuoteAware(s string) ([]string, error) {
+	tokens, err := ShellSplitTokens(s, SplitOptions{SplitFn: func(r rune) bool { return r == '\n' }})
+	if err != nil {
+		return nil, WrapTraceableErrorf(err, "failed to split %q into lines", s)
+	}
+	if tokens == nil {
+		return nil, nil
+	}
+	lines := make([]string, len(tokens))
+	for i, t := range tokens {
+		lines[i] = t.Raw
+	}
+	return lines, nil
+}
+
+// LogicalLines returns an iterator over the logical lines of input: a physical line that ends inside
+// quotes is joined, with its newline, to the lines after it until the quote closes, so a quoted value
+// can span several lines. Lines are yielded as written, without their final newline, blank ones
+// included; a quote never closed takes the rest of input with it. A read error is yielded last.
+func LogicalLines(input string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		lr := newLineReader(input, "")
+		for line, _, ok := lr.next(); ok; line, _, ok = lr.next() {
+			if !yield(line, nil) {
+				return
+			}
+		}
+		if err := lr.err(); err != nil {
+			yield("", WrapTraceableErrorf(err, "failed to read lines"))
+		}
+	}
+}
+
+// lineReader reads the logical lines of its input (see LogicalLines) one at a time, ignoring quotes in
+// comments started by the runes of comments.
+type lineReader struct {
+	scanner  *bufio.Scanner
+	comments string
+	lineNo   int // number of the last physical line read
+}
+
+func newLineReader(input string, comments string) *lineReader {
+	return &lineReader{scanner: bufio.NewScanner(strings.NewReader(input)), comments: comments}
+}
+
+// next returns the next logical line and the number of its first physical line; ok is false at the end.
+func (lr *lineReader) next() (line string, lineNo int, ok bool) {
+	if !lr.scanner.Scan() {
+		return "", 0, false
+	}
+	lr.lineNo++
+	line, lineNo = lr.scanner.Text(), lr.lineNo
+	for openQuote(line, lr.comments) && lr.scanner.Scan() {
+		line += "\n" + lr.scanner.Text()
+		lr.lineNo++
+	}
+	return line, lineNo, true
+}
+
+// err returns the error that stopped next, if any.
+func (lr *lineReader) err() error {
+	return lr.scanner.Err()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLinesQuoteAware(t *testing.T) {
+	got, err := SplitLinesQuoteAware("a \"b\nc\" d\ne")
+	if want := []string{"a \"b\nc\" d", "e"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitLinesQuoteAware = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestLogicalLines(t *testing.T) {
+	var got []string
+	for line, err := range LogicalLines("a = \"x\ny\"\nb = 1\nc = 2\n") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, line)
+		if line == "b = 1" {
+			break // stopping early must not panic
+		}
+	}
+	if want := []string{"a = \"x\ny\"", "b = 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LogicalLines = %q, want %q", got, want)
+	}
+}
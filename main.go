@@ -1,183 +1,145 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-  "unicode"
-  "unicode/utf8"
-  "strings"
-  "bufio"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 func WrapTraceableErrorf(err error, format string, args ...interface{}) error {
-  msg := fmt.Sprintf(format, args...)
-  return fmt.Errorf("%s: %w", msg, err)
+	msg := fmt.Sprintf(format, args...)
+	if err == nil {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
 }
 
+// ShellSplit splits s on whitespace like a shell would split a command line. A token ends only at an
+// unquoted split rune: quoted segments are concatenated with whatever touches them, with their quotes
+// removed, so `a"b c"d` is "ab cd" and adjacent assignments such as `FOO="a b"BAR="c"` make up the single
+// token "FOO=a bBAR=c".
+//
+// ASCII input without quotes or backslashes has nothing to unquote, so it is split by strings.Fields,
+// which is nearly ten times faster than the scanner (see BenchmarkShellSplitPlain).
 func ShellSplit(s string) ([]string, error) {
+	if isPlainASCII(s) {
+		if fields := strings.Fields(s); len(fields) > 0 {
+			return fields, nil
+		}
+		return nil, nil
+	}
 	return ShellSplitEx(s, unicode.IsSpace)
 }
 
-func ShellSplitEx(s string, splitFn func(rune) bool) ([]string, error) {
-	ss := make([]string, 0)
-	b := []byte(s)
-	l := len(b)
-	idx := 0 // next rune index
-	// define convenient functions with closure
-	skipSplitCh := func() error { // skip spaces
-		for idx < l {
-			r, s := utf8.DecodeRune(b[idx:])
-			if r == utf8.RuneError { // invalid Unicode encoding
-				return WrapTraceableErrorf(nil,
-					"failed to skip spaces: invalid Unicode encoding char '%c' at index %d (%s)",
-					b[idx], idx, string(b[:idx]))
-			}
-			if !splitFn(r) { // done, stop at the non-split rune
-				break
-			}
-			idx += s
+// isPlainASCII reports whether s is all ASCII with no quote or backslash, so that splitting it on
+// unicode.IsSpace is strings.Fields.
+func isPlainASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= utf8.RuneSelf || c == '"' || c == '\'' || c == '\\' {
+			return false
 		}
-		// end of string
-		return nil
 	}
-	findEndQuote := func(q rune) error { // find the end matching quote
-		prev := utf8.RuneError
-		for idx < l {
-			r, s := utf8.DecodeRune(b[idx:])
-			if r == utf8.RuneError { // invalid Unicode encoding
-				return WrapTraceableErrorf(nil,
-					"failed to find end matching quote: invalid Unicode encoding char '%c' at index %d (%s)",
-					b[idx], idx, string(b[:idx]))
-			}
-			idx += s
-			if r == q {
-				if prev != '\\' { // found it
-					return nil
-				}
-				// escaped quote
-			}
-			prev = r
-		}
-		// end of string
-		return WrapTraceableErrorf(nil, "no end matching quote (%c) found", q)
+	return true
+}
+
+// ShellSplitEx splits s on the runes for which splitFn returns true, honoring quotes. Quote handling
+// takes precedence: a quote character opens a quoted segment even if splitFn reports it as a split rune.
+// A run of split runes is a single delimiter, and leading and trailing ones are ignored, so split runes
+// alone never make an empty token: "  a   b  " is "a" and "b". An empty token only comes from empty
+// quotes (`a "" b`), or from a hard split rune (see SplitOptions.HardSplitFn) for empty fields.
+func ShellSplitEx(s string, splitFn func(rune) bool) ([]string, error) {
+	b := []byte(s)
+	sc := newScanner(b, &SplitOptions{SplitFn: splitFn})
+	return sc.splitInto(make([]string, 0, estimateFields(b, splitFn)))
+}
+
+// EstimateFields returns a cheap upper bound of the number of tokens ShellSplitEx(s, splitFn) returns,
+// e.g. to size a buffer: it counts the runs of runes between split runes, without parsing quotes, so
+// split runes in quotes only make it bigger. A nil splitFn stands for unicode.IsSpace.
+func EstimateFields(s string, splitFn func(rune) bool) int {
+	return estimateFields([]byte(s), splitFn)
+}
+
+// estimateFields is EstimateFields for input held as a []byte.
+func estimateFields(b []byte, splitFn func(rune) bool) int {
+	if splitFn == nil {
+		splitFn = defaultSplitFn
 	}
-	findSplitCh := func() error { // find the next space to split
-		prev := utf8.RuneError
-		for idx < l {
-			r, s := utf8.DecodeRune(b[idx:])
-			if r == utf8.RuneError { // invalid Unicode encoding
-				return WrapTraceableErrorf(nil,
-					"failed to find next space: invalid Unicode encoding char '%c' at index %d (%s)",
-					b[idx], idx, string(b[:idx]))
-			}
-			if splitFn(r) { // found it
-				return nil
-			}
-			idx += s
-			if r == '"' || r == '\'' { // quote
-				if prev == '\\' { // escaped quote
-					prev = r
-					continue
-				}
-				start := idx
-				if err := findEndQuote(r); err != nil { // find the matching end quote
-					return WrapTraceableErrorf(err, "failed to find the matching quote starting at index %d (%s)",
-						start, string(b[:start]))
-				}
-			}
-			prev = r
+	n, inField := 0, false
+	for i := 0; i < len(b); {
+		r, s := utf8.DecodeRune(b[i:])
+		i += s
+		if r != '"' && r != '\'' && splitFn(r) { // quotes are never split runes
+			inField = false
+		} else if !inField {
+			inField = true
+			n++
 		}
-		// end of string
-		return nil
 	}
+	return n
+}
+
+// ShellSplitBytes is ShellSplitEx for input already held as a []byte (e.g. a file read).
+// It scans b in place without copying it; only the returned tokens are allocated.
+func ShellSplitBytes(b []byte, splitFn func(rune) bool) ([]string, error) {
+	sc := newScanner(b, &SplitOptions{SplitFn: splitFn})
+	return sc.splitInto(make([]string, 0, estimateFields(b, splitFn)))
+}
 
-	var start int
-	for idx < l {
-		if err := skipSplitCh(); err != nil {
+// ShellSplitByteTokens is ShellSplitBytes without the string allocations: a token spelled in b exactly
+// as it comes out, such as any token without quotes, is a view of b (capped, so appending to it does not
+// overwrite b), and only tokens changed by quote removal are copies. Views share b's memory, so b must
+// not be modified while they are in use.
+func ShellSplitByteTokens(b []byte, splitFn func(rune) bool) ([][]byte, error) {
+	sc := newScanner(b, &SplitOptions{SplitFn: splitFn})
+	tokens := make([][]byte, 0)
+	for {
+		start, ok, err := sc.next()
+		if err != nil {
 			return nil, err
 		}
-		start = idx
-		if err := findSplitCh(); err != nil {
-			return nil, err
+		if !ok {
+			break
 		}
-		if start < idx {
-			if b[start] == b[idx-1] && (b[start] == '"' || b[start] == '\'') {
-				// remove the surrounding quotes
-				ss = append(ss, string(b[start+1:idx-1]))
-			} else {
-				ss = append(ss, string(b[start:idx]))
-			}
+		if raw := b[start:sc.idx:sc.idx]; bytes.Equal(raw, sc.tok) {
+			tokens = append(tokens, raw)
+		} else {
+			tokens = append(tokens, append([]byte(nil), sc.tok...))
 		}
 	}
-	if len(ss) == 0 {
+	if len(tokens) == 0 {
 		return nil, nil
 	}
-	return ss, nil
+	return tokens, nil
 }
 
-func ParseBootConfig(input string) ([]string, error) {
-	// $ cat /proc/bootconfig
-	// CabCmdBranches = "test\x20me", "here", "ok"
-	// CabCmdDryRun = "1"
-	// CabServer = "10.10.1.234"
-	cmds := make([]string, 0)
-	scanner := bufio.NewScanner(strings.NewReader(input))
-	for scanner.Scan() {
-		line := scanner.Text()
-		kv := strings.SplitN(line, "=", 2)
-		if l := len(kv); l != 2 {
-			return nil, WrapTraceableErrorf(nil, "failed to parse /proc/bootconfig output line %q: missing '='", line)
-		}
-		key := strings.TrimSpace(kv[0])
-		fields, err := ShellSplitEx(kv[1], func(r rune) bool {
-			return unicode.IsSpace(r) || r == ','
-		})
-		if err != nil {
-			return nil, WrapTraceableErrorf(err, "failed to parse /proc/bootconfig output line %q after '='", line)
-		}
-		value := strings.Join(fields, ",")
-		cmds = append(cmds, fmt.Sprintf("%s=%s", key, value))
+// SplitByte splits b at every sep byte, for fixed-format records using a separator such as the unit
+// separator 0x1F: there is no rune decoding or quoting, so any bytes can be split. Every sep ends a
+// field, so n separators make n+1 fields, and leading, trailing and adjacent separators make empty
+// fields: "\x1fa\x1f\x1f" is "", "a", "" and "". An empty b has no fields. The fields are views of b,
+// capped so that appending to one does not overwrite the next.
+func SplitByte(b []byte, sep byte) [][]byte {
+	if len(b) == 0 {
+		return nil
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, WrapTraceableErrorf(err, "failed to parse /proc/bootconfig output")
+	fields := make([][]byte, 0, bytes.Count(b, []byte{sep})+1)
+	for {
+		i := bytes.IndexByte(b, sep)
+		if i < 0 {
+			return append(fields, b[:len(b):len(b)])
+		}
+		fields = append(fields, b[:i:i])
+		b = b[i+1:]
 	}
-	return cmds, nil
 }
 
 func main() {
-  cmd := `test me "here and there" ok`
-  fields, err := ShellSplit(cmd)
-  if err != nil {
-    fmt.Printf("ERROR: Failed to shell-split %q: %+v\n", cmd, err)
-  }
-	fmt.Printf("Shell Split: %q\n", fields)
-  
-  cmd = ` "test\x20me", "here", "ok"`
-  fields, err = ShellSplitEx(cmd, func(r rune) bool {
-    return unicode.IsSpace(r) || r == ','
-  })
-  if err != nil {
-    fmt.Printf("ERROR: Failed to shellSplitEx %q: %+v\n", cmd, err)
-  }
-	fmt.Printf("Shell Split Ex: %q\n", fields)
-
-  cmd = `CabCmdBranches = "test me","here, \"quoted\", \'too\', there" "ok"`
-  fields, err = ShellSplitEx(cmd, func(r rune) bool {
-    return unicode.IsSpace(r) || r == ','
-  })
-  if err != nil {
-    fmt.Printf("ERROR: Failed to shellSplitEx %q: %+v\n", cmd, err)
-  }
-	fmt.Printf("Shell Split Ex: %q\n", fields)
-
-  fields, err = ParseBootConfig(bootcfg)
-  if err != nil {
-    fmt.Printf("ERROR: Failed to ParseBootConfig %q: %+v\n", cmd, err)
-  }
-	fmt.Printf("cmds: %q\n", fields)
-
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "shellsplit: %v\n", err)
+		os.Exit(1)
+	}
 }
-
-const bootcfg = `kernel.CabCmdBranches = "test\x20me", "here", "ok"
-kernel.CabCmdDryRun = "1"
-kernel.CabIP = "10.10.1.234"
-`
\ No newline at end of file
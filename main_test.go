@@ -0,0 +1,169 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestShellSplitBytes(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"   ",
+		`a b c`,
+		`a "b c" 'd e' f\ g`,
+		` "test\x20me", "here", "ok"`,
+		"é  ü",
+	} {
+		want, wantErr := ShellSplitEx(s, unicode.IsSpace)
+		got, err := ShellSplitBytes([]byte(s), unicode.IsSpace)
+		if !reflect.DeepEqual(got, want) || (err == nil) != (wantErr == nil) {
+			t.Errorf("ShellSplitBytes(%q) = %q, %v; want %q, %v", s, got, err, want, wantErr)
+		}
+	}
+	if _, err := ShellSplitBytes([]byte(`a "b`), nil); err == nil {
+		t.Error(`ShellSplitBytes("a \"b") succeeded; want an error`)
+	}
+}
+
+var benchLine = []byte(strings.Repeat(`exec --name="some value" /usr/local/bin/tool -v `, 100))
+
+func BenchmarkShellSplitBytes(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ShellSplitBytes(benchLine, unicode.IsSpace); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkShellSplitExFromBytes(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ShellSplitEx(string(benchLine), unicode.IsSpace); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestShellSplitAdjacentAssignments(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{`FOO="a b"BAR="c"`, []string{"FOO=a bBAR=c"}},
+		{`FOO="a b"BAR`, []string{"FOO=a bBAR"}},
+		{`FOO="a b" BAR="c"`, []string{"FOO=a b", "BAR=c"}},
+	} {
+		if got, err := ShellSplit(tc.in); err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ShellSplit(%s) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestShellSplitCollapsesSplitRuns(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"  a   b  ", []string{"a", "b"}},
+		{"\t a \n\n b \r", []string{"a", "b"}},
+		{"   ", nil},
+		{`a "" b`, []string{"a", "", "b"}}, // only empty quotes make an empty token
+	} {
+		if got, err := ShellSplit(tc.in); err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ShellSplit(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+	// a hard split rune, unlike a run of soft ones, makes empty fields
+	got, err := ShellSplitWithOptions("a,,b", SplitOptions{HardSplitFn: func(r rune) bool { return r == ',' }})
+	if want := []string{"a", "", "b"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf(`hard split of "a,,b" = %q, %v; want %q`, got, err, want)
+	}
+}
+
+func TestShellSplitPlainASCII(t *testing.T) {
+	for _, s := range []string{
+		"", "   ", "a", "  a   b  ", "\t\v\f\r\n a\x00b \x7f", "a}{b %41 $x ;&| --k=v",
+		plainLine,
+	} {
+		got, err := ShellSplit(s)
+		if err != nil {
+			t.Fatalf("ShellSplit(%q): %v", s, err)
+		}
+		scanned, _ := ShellSplitEx(s, unicode.IsSpace) // the scanner, without the fast path
+		if !reflect.DeepEqual(got, scanned) {
+			t.Errorf("ShellSplit(%q) = %q, but the scanner gives %q", s, got, scanned)
+		}
+		if fields := strings.Fields(s); len(fields) > 0 && !reflect.DeepEqual(got, fields) {
+			t.Errorf("ShellSplit(%q) = %q, but strings.Fields gives %q", s, got, fields)
+		}
+	}
+}
+
+var plainLine = strings.Repeat("alpha beta\tgamma  delta --flag=value /usr/local/bin ", 20)
+
+func BenchmarkStringsFields(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		strings.Fields(plainLine)
+	}
+}
+
+func BenchmarkShellSplitPlain(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ShellSplit(plainLine)
+	}
+}
+
+func BenchmarkShellSplitExPlain(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ShellSplitEx(plainLine, unicode.IsSpace)
+	}
+}
+
+func TestShellSplitByteTokensShareInput(t *testing.T) {
+	b := []byte(`ab "c d" ef`)
+	got, err := ShellSplitByteTokens(b, nil)
+	if want := [][]byte{[]byte("ab"), []byte("c d"), []byte("ef")}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("ShellSplitByteTokens(%q) = %q, %v; want %q", b, got, err, want)
+	}
+	if &got[0][0] != &b[0] || &got[2][0] != &b[9] {
+		t.Error("unquoted tokens do not share the backing array of the input")
+	}
+}
+
+func TestSplitByte(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{",a,,b,", []string{"", "a", "", "b", ""}}, // leading, adjacent and trailing separators
+		{",", []string{"", ""}},
+		{"ab", []string{"ab"}},
+		{"", nil},
+	} {
+		var got []string
+		for _, f := range SplitByte([]byte(tc.in), ',') {
+			got = append(got, string(f))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SplitByte(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestEstimateFields(t *testing.T) {
+	for _, s := range []string{"", "a", "  a  b  ", `"a b" 'c' d\ e`, `a "" b`, "a\tb\nc", string(benchLine)} {
+		fields, err := ShellSplitEx(s, unicode.IsSpace)
+		if err != nil {
+			t.Fatalf("ShellSplitEx(%q): %v", s, err)
+		}
+		if est := EstimateFields(s, unicode.IsSpace); est < len(fields) {
+			t.Errorf("EstimateFields(%q) = %d, but it splits into %d fields", s, est, len(fields))
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultSplitFn is the split function used by ShellSplit and when SplitOptions.SplitFn is nil.
+var defaultSplitFn = unicode.IsSpace
+
+// StandardShellSpace reports whether r is one of the blanks a POSIX shell splits words on: space, tab,
+// newline and carriage return. Unlike unicode.IsSpace, the default split function, it does not match
+// vertical tab, form feed, U+0085 (NEL) or any other Unicode space, so those stay inside tokens.
+func StandardShellSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// UnicodeSeparator reports whether r separates words in internationalized text: it is a space per
+// unicode.IsSpace or a rune of the Unicode separator categories, Zs (space, such as the ideographic
+// space), Zl (U+2028 LINE SEPARATOR) and Zp (U+2029 PARAGRAPH SEPARATOR). Going by category keeps it
+// complete should a new separator be added to Unicode before the White_Space list IsSpace relies on.
+func UnicodeSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.In(r, unicode.Zs, unicode.Zl, unicode.Zp)
+}
+
+// RuneSet returns a split function matching the runes of s, e.g. RuneSet(" ,;"). ASCII runes are
+// looked up in a table and the others in a map, so it is cheaper than a closure calling
+// strings.ContainsRune for each rune of the input.
+func RuneSet(s string) func(rune) bool {
+	var ascii [utf8.RuneSelf]bool
+	var others map[rune]bool
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii[r] = true
+		} else {
+			if others == nil {
+				others = make(map[rune]bool)
+			}
+			others[r] = true
+		}
+	}
+	return func(r rune) bool {
+		if r >= 0 && r < utf8.RuneSelf {
+			return ascii[r]
+		}
+		return others[r]
+	}
+}
+
+// SplitOptions controls how ShellSplitWithOptions and ShellSplitTokens split their input.
+// The zero value splits like ShellSplit.
+type SplitOptions struct {
+	// SplitFn reports whether a rune separates tokens; unicode.IsSpace is used if it is nil.
+	// It is never consulted for quote characters: those always open a quoted segment.
+	SplitFn func(rune) bool
+	// HardSplitFn, if set, reports the "hard" split runes, such as ',' in a comma separated list. Unlike
+	// the "soft" runes of SplitFn, runs of which collapse into one delimiter, each hard split rune ends
+	// a field, so `a ,, b` is "a", "" and "b": soft runes around hard ones are ignored, and a field with
+	// no token in it (between two hard runes, or before the first or after the last one) is an empty token.
+	HardSplitFn func(rune) bool
+	// DecodeEscapes turns on backslash escape processing: outside quotes a backslash escapes the next rune
+	// (so `a\ b` is a single token), and both outside quotes and inside double quotes the sequences \a \b
+	// \f \n \r \t \v \0 and \xNN are decoded. Any other escaped rune stands for itself, so `\"quoted\"` is
+	// the token "quoted" with its quotes. Without it, a backslash is kept verbatim and only stops a
+	// following quote from opening or closing a quoted segment.
+	// Either way, single quotes are fully literal: a backslash in them is an ordinary rune, so `'a\'` is a\.
+	DecodeEscapes bool
+	// KeepEscapes keeps the escape sequences DecodeEscapes recognizes in the tokens as written, so they
+	// still split (`a\ b` is one token) and quote as decoded, but `a\ b` is `a\ b`, for callers that
+	// decode tokens themselves.
+	KeepEscapes bool
+	// MaxConsecutiveEscapes, if positive, is the longest run of backslashes allowed outside single quotes;
+	// a longer one is an EscapeError, as a guard against adversarial input.
+	MaxConsecutiveEscapes int
+	// LiteralBackslashUnquoted makes a backslash outside quotes an ordinary rune, as in Windows paths:
+	// `C:\path\to file` is `C:\path\to` and "file", and `a\"b c"` is `a\b c`. In double quotes it still
+	// escapes as configured.
+	LiteralBackslashUnquoted bool
+	// TraceFunc, if not nil, is called with one of the Trace events and the byte index it happened at as
+	// the input is scanned, to see why it splits the way it does.
+	TraceFunc func(event string, pos int)
+	// DecodePercent decodes URL-style %XX sequences into the byte they stand for, outside quotes and
+	// inside double quotes; a '%' not followed by two hex digits is then an EscapeError.
+	DecodePercent bool
+	// TrimRunes lists pairs of opening and closing runes, like "<>[]", to strip from around each token
+	// after quote removal: `<a> [b]` is "a" and "b". One pair is removed, and only if both of its runes
+	// are present and enclose the whole token, so `<a` and `<a>b<c>` are kept as is.
+	TrimRunes string
+	// TokenFunc, if set, rewrites each token (after quote removal and escape decoding) before it is
+	// returned, e.g. to expand variables; an error from it aborts the split.
+	TokenFunc func(token string) (string, error)
+	// LenientQuotes makes a quote that is never closed an ordinary character instead of an error,
+	// so `it's here` splits into "it's" and "here", and an input made of a lone quote is that quote.
+	LenientQuotes bool
+	// NormalizeSpace turns every non-ASCII Unicode space (NBSP, ideographic space, ...) into an ASCII space
+	// before it is matched against SplitFn or stored in a token, for text pasted from word processors.
+	NormalizeSpace bool
+	// BraceQuotes adds Tcl-style brace quoting: a '{' at the start of a token quotes up to its matching
+	// '}'. Braces nest, and only the outermost pair is removed, so `{a {b c} d}` is "a {b c} d".
+	BraceQuotes bool
+	// MaxQuoteSpan, if positive, is the most runes a quoted segment may hold (an escape sequence counts
+	// as one); a quote left open by mistake is then reported where it opened, as a QuoteSpanError, rather
+	// than swallowing the rest of the input.
+	MaxQuoteSpan int
+	// SmartQuotes also recognizes the curly quotes of text pasted from editors: U+201C/U+201D and
+	// U+2018/U+2019 open and close quoted segments like " and ' do.
+	SmartQuotes bool
+	// CacheASCII calls SplitFn once per ASCII rune at the start of each split and looks the results up
+	// in a table afterwards, which pays off when SplitFn is expensive. Non-ASCII runes still go to SplitFn.
+	CacheASCII bool
+	// InvalidUTF8 selects what happens to bytes that are not valid UTF-8.
+	InvalidUTF8 InvalidUTF8Mode
+	// FallbackCP1252 decodes a byte that is not valid UTF-8 as Windows-1252 instead, for logs mixing both
+	// encodings: 0x93 is then U+201C (a quote with SmartQuotes) and 0xE9 is 'é'. InvalidUTF8 only applies
+	// to the five bytes Windows-1252 leaves undefined.
+	FallbackCP1252 bool
+	// ValidateUTF8 checks that the whole input is valid UTF-8 before splitting it, so invalid input fails
+	// with a single EncodingError for its first invalid byte before any token is produced. It takes
+	// precedence over InvalidUTF8 and FallbackCP1252.
+	ValidateUTF8 bool
+	// QuotePolicy, if set, replaces the built-in removal of quotes and decoding of escapes in each quoted
+	// segment: the segment still ends where the built-in rules say, but what it contributes to its token
+	// is what QuotePolicy.StripAndDecode returns for it.
+	QuotePolicy QuotePolicy
+	// SplitOnEquals splits each token once more, at its first '=' outside quotes, into the part before it
+	// and the part after it, so `--opt=val "a=b"` is "--opt", "val" and "a=b" and `a=` is "a" and "".
+	// Any later '=' in the token is kept, and so is one escaped with DecodeEscapes.
+	SplitOnEquals bool
+	// OpaqueSubstitution keeps command and process substitutions, $(...) and <(...), as written: up to
+	// its balanced closing parenthesis, a substitution is part of the token it is in, quotes, escapes and
+	// split runes included, so `echo $(ls "a b")` is "echo" and `$(ls "a b")`.
+	OpaqueSubstitution bool
+	// MaxDepth, if positive, is how deep the features that nest, brace quotes and substitutions, may nest
+	// (the outermost pair is depth 1); deeper nesting is a DepthError, so hostile input cannot make the
+	// bookkeeping of nesting grow without bound.
+	MaxDepth int
+	// ClassifyOperators recognizes the redirection operators <, >, <<, >>, <>, optionally preceded by a
+	// file descriptor and followed by & and one, as in 2>&1, outside quotes. Each is a token of its own,
+	// even without spaces around it (`foo>bar` is "foo", ">" and "bar"), which ShellSplitTokens reports as
+	// a TokenOperator. Digits only make up the file descriptor if nothing else precedes the operator.
+	ClassifyOperators bool
+	// WarnQuoteMismatch adds a warning (see ShellSplitWithWarnings) for each quoted segment holding an odd
+	// number of the other ASCII quote, as "a'b" does, a likely quoting mistake. It is a heuristic: an
+	// apostrophe, as in "it's", is warned about too, while balanced nesting such as "say 'hi'" is not.
+	WarnQuoteMismatch bool
+	// WarnConfusableQuotes adds a warning (see ShellSplitWithWarnings) for each rune outside quotes that
+	// looks like a quote but is not one, such as U+201D or U+2033 (″) in pasted text. The rune is still
+	// taken literally; the warning flags input that may not split the way it reads.
+	WarnConfusableQuotes bool
+	// BlockComments strips /* ... */ comments outside quotes, which may span lines. A comment separates
+	// tokens like a split rune does, so `a /* x y */ b` and `a/**/b` both are "a" and "b". A comment left
+	// open is an UnterminatedCommentError.
+	BlockComments bool
+	// DefaultToken, if not empty, is the token returned for an input without any (empty or blank), for
+	// callers that need at least one, such as a default command. ShellSplitTokens ignores it.
+	DefaultToken string
+}
+
+// InvalidUTF8Mode selects how invalid UTF-8 in the input is handled.
+type InvalidUTF8Mode int
+
+const (
+	InvalidUTF8Error   InvalidUTF8Mode = iota // fail with an EncodingError (the default)
+	InvalidUTF8Replace                        // replace each invalid byte with U+FFFD
+	InvalidUTF8Skip                           // drop invalid bytes
+)
+
+// Token is a token produced by ShellSplitTokens along with where it came from.
+type Token struct {
+	Value string // the token after quote removal (and escape decoding, if enabled)
+	Raw   string // the literal source text of the token, quotes and escapes intact
+	Start int    // byte index of the first byte of the token
+	End   int    // byte index just past the last byte of the token
+	// StartRune and EndRune are Start and End counted in runes rather than bytes (an invalid byte
+	// counts as one rune), i.e. the columns of the token for Unicode-aware diagnostics.
+	StartRune int
+	EndRune   int
+	// Quoted reports whether the token has a quoted segment.
+	Quoted bool
+	// Kind tells words from the operators ClassifyOperators recognizes.
+	Kind TokenKind
+	// LeadingSep is the input between the previous token (or the start of the input) and this one, such
+	// as the exact run of spaces or commas, so a formatter can keep the original spacing.
+	LeadingSep string
+	// Segments are the quoted segments of the token, in order.
+	Segments []Segment
+}
+
+// Segment is a quoted segment of a Token.
+type Segment struct {
+	Quote rune // the opening quote
+	Start int  // byte index of the opening quote
+	End   int  // byte index just past the closing quote
+	// RawInner is the source text between the quotes and DecodedInner what it adds to the token, with
+	// escapes decoded by DecodeEscapes or a QuotePolicy: with DecodeEscapes, the RawInner `a\tb` of
+	// "a\tb" is "a<TAB>b" once decoded.
+	RawInner     string
+	DecodedInner string
+}
+
+// The events passed to SplitOptions.TraceFunc.
+const (
+	TraceQuoteOpen  = "quote open"  // a quoted segment opens at the quote
+	TraceQuoteClose = "quote close" // a quoted segment closes at the quote
+	TraceEscape     = "escape"      // an escape sequence starts at the backslash
+	TraceToken      = "token"       // a token starting there is emitted
+)
+
+// TokenKind is the kind of a Token.
+type TokenKind int
+
+const (
+	TokenWord     TokenKind = iota // an ordinary token
+	TokenOperator                  // a redirection operator, such as > or 2>&1
+)
+
+// kind returns the kind of the token just scanned.
+func (sc *scanner) kind() TokenKind {
+	if sc.operator {
+		return TokenOperator
+	}
+	return TokenWord
+}
+
+// ShellSplitWithOptions splits s like ShellSplitEx, as configured by opts.
+func ShellSplitWithOptions(s string, opts SplitOptions) ([]string, error) {
+	return splitBytes([]byte(s), &opts)
+}
+
+// ShellSplitTokens splits s like ShellSplitWithOptions but returns each token with its source text and position.
+func ShellSplitTokens(s string, opts SplitOptions) ([]Token, error) {
+	return splitTokens(s, opts, nil)
+}
+
+// splitTokens is ShellSplitTokens calling scanned, if not nil, with the scanner after each token.
+func splitTokens(s string, opts SplitOptions, scanned func(sc *scanner)) ([]Token, error) {
+	b := []byte(s)
+	sc := newScanner(b, &opts)
+	sc.wantSegments = true
+	tokens := make([]Token, 0)
+	at, runes := 0, 0 // runes counted up to byte index at
+	for {
+		start, ok, err := sc.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		value, err := sc.value(start)
+		if err != nil {
+			return nil, err
+		}
+		sep, startRune := s[at:start], runes+utf8.RuneCount(b[at:start])
+		runes, at = startRune+utf8.RuneCount(b[start:sc.idx]), sc.idx
+		tokens = append(tokens, Token{Value: value, Raw: s[start:sc.idx], Start: start, End: sc.idx,
+			StartRune: startRune, EndRune: runes, Quoted: sc.quoted, Kind: sc.kind(), LeadingSep: sep,
+			Segments: sc.segments})
+		if scanned != nil {
+			scanned(sc)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return tokens, nil
+}
+
+// TokenAtOffset returns the token of s, split like ShellSplit, that the byte at offset belongs to, e.g.
+// the token under the cursor in an editor. It returns nil if offset is in the whitespace between tokens
+// or outside s.
+func TokenAtOffset(s string, offset int) (*Token, error) {
+	tokens, err := ShellSplitTokens(s, SplitOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		if t := &tokens[i]; t.Start <= offset && offset < t.End {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+// ShellSplitNonEmpty splits s like ShellSplitEx but fails, naming its position, if a token is empty, as
+// made by empty quotes (`a "" b`), for inputs where an empty argument is invalid.
+func ShellSplitNonEmpty(s string, splitFn func(rune) bool) ([]string, error) {
+	tokens, err := ShellSplitTokens(s, SplitOptions{SplitFn: splitFn})
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		return nil, nil
+	}
+	fields := make([]string, len(tokens))
+	for i, t := range tokens {
+		if t.Value == "" {
+			return nil, WrapTraceableErrorf(nil, "token %d (%s) at index %d is empty", i, t.Raw, t.Start)
+		}
+		fields[i] = t.Value
+	}
+	return fields, nil
+}
+
+// ShellSplitJoined splits s like ShellSplitEx and joins the tokens with sep, e.g. "\n" for display,
+// writing each token straight into the result instead of building a slice of them first.
+func ShellSplitJoined(s string, splitFn func(rune) bool, sep string) (string, error) {
+	sc := newScanner([]byte(s), &SplitOptions{SplitFn: splitFn})
+	var sb strings.Builder
+	for n := 0; ; n++ {
+		_, ok, err := sc.next()
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			break
+		}
+		if n > 0 {
+			sb.WriteString(sep)
+		}
+		sb.Write(sc.tok)
+	}
+	return sb.String(), nil
+}
+
+// ShellSplitWithWarnings splits s like ShellSplitWithOptions and also returns the recoverable anomalies
+// it met, such as a quote taken literally under LenientQuotes, a dangling backslash or a dropped
+// invalid byte, so callers can log them without failing.
+func ShellSplitWithWarnings(s string, opts SplitOptions) (fields []string, warnings []string, err error) {
+	sc := newScanner([]byte(s), &opts)
+	fields, err = sc.split()
+	return fields, sc.warnings, err
+}
+
+func splitBytes(b []byte, opts *SplitOptions) ([]string, error) {
+	return newScanner(b, opts).split()
+}
+
+// split returns the values of all the remaining tokens.
+func (sc *scanner) split() ([]string, error) {
+	return sc.splitInto(make([]string, 0))
+}
+
+// splitInto is split appending to ss, which may have been preallocated.
+func (sc *scanner) splitInto(ss []string) ([]string, error) {
+	for {
+		start, ok, err := sc.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		value, err := sc.value(start)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, value)
+	}
+	if len(ss) == 0 {
+		if sc.opts.DefaultToken != "" {
+			return []string{sc.opts.DefaultToken}, nil
+		}
+		return nil, nil
+	}
+	return ss, nil
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// expensiveDelims is a long list of delimiters, which expensiveSplitFn checks one by one.
+var expensiveDelims = func() []rune {
+	delims := []rune(" ,;:|/\t\n¦·")
+	for r := rune(0x2100); r < 0x2200; r++ { // letterlike symbols, arrows
+		delims = append(delims, r)
+	}
+	return delims
+}()
+
+func expensiveSplitFn(r rune) bool {
+	for _, d := range expensiveDelims {
+		if d == r {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCacheASCII(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"a,b;c d",
+		`a,"b;c",d:e|f/g`,
+		"é,ü¦x·y z→w",
+		"\x00 \x7f",
+	} {
+		want, wantErr := ShellSplitWithOptions(s, SplitOptions{SplitFn: expensiveSplitFn})
+		got, err := ShellSplitWithOptions(s, SplitOptions{SplitFn: expensiveSplitFn, CacheASCII: true})
+		if !reflect.DeepEqual(got, want) || (err == nil) != (wantErr == nil) {
+			t.Errorf("CacheASCII split of %q = %q, %v; want %q, %v", s, got, err, want, wantErr)
+		}
+	}
+}
+
+var cacheInput = strings.Repeat("alpha,beta;gamma delta:epsilon|zeta/eta ", 50)
+
+func BenchmarkExpensiveSplitFn(b *testing.B) {
+	opts := SplitOptions{SplitFn: expensiveSplitFn}
+	for i := 0; i < b.N; i++ {
+		ShellSplitWithOptions(cacheInput, opts)
+	}
+}
+
+func BenchmarkExpensiveSplitFnCacheASCII(b *testing.B) {
+	opts := SplitOptions{SplitFn: expensiveSplitFn, CacheASCII: true}
+	for i := 0; i < b.N; i++ {
+		ShellSplitWithOptions(cacheInput, opts)
+	}
+}
+
+func TestTokenSegments(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		opts SplitOptions
+		want []Segment
+	}{
+		{`x"a\tb"'c'`, SplitOptions{DecodeEscapes: true}, []Segment{
+			{Quote: '"', Start: 1, End: 7, RawInner: `a\tb`, DecodedInner: "a\tb"},
+			{Quote: '\'', Start: 7, End: 10, RawInner: "c", DecodedInner: "c"},
+		}},
+		{"“é”", SplitOptions{SmartQuotes: true}, []Segment{
+			{Quote: '“', Start: 0, End: 8, RawInner: "é", DecodedInner: "é"},
+		}},
+		{"\x93ab\x94", SplitOptions{SmartQuotes: true, FallbackCP1252: true}, []Segment{
+			{Quote: '“', Start: 0, End: 4, RawInner: "ab", DecodedInner: "ab"},
+		}},
+		{"plain", SplitOptions{}, nil},
+	} {
+		tokens, err := ShellSplitTokens(tc.in, tc.opts)
+		if err != nil {
+			t.Fatalf("ShellSplitTokens(%q): %v", tc.in, err)
+		}
+		if got := tokens[0].Segments; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("segments of %q = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRuneSet(t *testing.T) {
+	in := RuneSet(" ,;")
+	for _, r := range " ,;" {
+		if !in(r) {
+			t.Errorf("RuneSet(\" ,;\")(%q) = false", r)
+		}
+	}
+	for _, r := range "a\t:é " {
+		if in(r) {
+			t.Errorf("RuneSet(\" ,;\")(%q) = true", r)
+		}
+	}
+	if in(-1) || !RuneSet("é")('é') {
+		t.Error("RuneSet mishandles runes outside ASCII")
+	}
+	got, err := ShellSplitEx(`a,b;"c,d" é e`, RuneSet(" ,;"))
+	if want := []string{"a", "b", "c,d", "é", "e"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf(`ShellSplitEx with RuneSet(" ,;") = %q, %v; want %q`, got, err, want)
+	}
+}
+
+var runeSetInput = strings.Repeat("alpha,beta;gamma delta,", 50)
+
+func BenchmarkRuneSet(b *testing.B) {
+	splitFn := RuneSet(" ,;")
+	for i := 0; i < b.N; i++ {
+		ShellSplitEx(runeSetInput, splitFn)
+	}
+}
+
+func BenchmarkRuneSetNaive(b *testing.B) {
+	splitFn := func(r rune) bool { return strings.ContainsRune(" ,;", r) }
+	for i := 0; i < b.N; i++ {
+		ShellSplitEx(runeSetInput, splitFn)
+	}
+}
+
+func TestTokenRawAndValue(t *testing.T) {
+	tokens, err := ShellSplitTokens(`x "a\tb"`, SplitOptions{DecodeEscapes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[1].Raw != `"a\tb"` || tokens[1].Value != "a\tb" {
+		t.Errorf(`tokens of x "a\tb" = %+v; want the second with Raw "a\tb" and Value a<TAB>b`, tokens)
+	}
+}
+
+func TestTokenFunc(t *testing.T) {
+	upper := SplitOptions{TokenFunc: func(s string) (string, error) { return strings.ToUpper(s), nil }}
+	checkSplits(t, upper, []splitCase{{`a "b c"`, []string{"A", "B C"}}})
+
+	errAbort := errors.New("abort")
+	abort := SplitOptions{TokenFunc: func(s string) (string, error) {
+		if s == "bad" {
+			return "", errAbort
+		}
+		return s, nil
+	}}
+	if _, err := ShellSplitWithOptions("a bad c", abort); !errors.Is(err, errAbort) {
+		t.Errorf(`ShellSplitWithOptions("a bad c") error = %v, want one wrapping %v`, err, errAbort)
+	}
+}
+
+func TestNormalizeSpace(t *testing.T) {
+	opts := SplitOptions{NormalizeSpace: true, SplitFn: func(r rune) bool { return r == ' ' }}
+	checkSplits(t, opts, []splitCase{
+		{"a\u00a0b\u3000c", []string{"a", "b", "c"}}, // NBSP and ideographic space
+		{"\"x\u00a0y\"", []string{"x y"}},
+	})
+	opts.NormalizeSpace = false
+	checkSplits(t, opts, []splitCase{{"a\u00a0b\u3000c", []string{"a\u00a0b\u3000c"}}})
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	const in = "a\xffb c"
+	var ee *EncodingError
+	_, err := ShellSplitWithOptions(in, SplitOptions{InvalidUTF8: InvalidUTF8Error})
+	if !errors.As(err, &ee) || ee.Offset != 1 {
+		t.Errorf("InvalidUTF8Error: error = %v, want an EncodingError at 1", err)
+	}
+	checkSplits(t, SplitOptions{InvalidUTF8: InvalidUTF8Replace}, []splitCase{{in, []string{"a�b", "c"}}})
+	checkSplits(t, SplitOptions{InvalidUTF8: InvalidUTF8Skip}, []splitCase{{in, []string{"ab", "c"}}})
+}
+
+func TestShellSplitWithWarnings(t *testing.T) {
+	fields, warnings, err := ShellSplitWithWarnings(`a "b`, SplitOptions{LenientQuotes: true})
+	if want := []string{"a", `"b`}; err != nil || !reflect.DeepEqual(fields, want) {
+		t.Errorf(`ShellSplitWithWarnings("a \"b") = %q, %v; want %q`, fields, err, want)
+	}
+	if want := []string{`unterminated quote (") at index 2 taken literally`}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+	if _, warnings, _ := ShellSplitWithWarnings(`a "b"`, SplitOptions{LenientQuotes: true}); warnings != nil {
+		t.Errorf("warnings for clean input = %q, want none", warnings)
+	}
+}
+
+func TestHardSplitFn(t *testing.T) {
+	comma := SplitOptions{HardSplitFn: func(r rune) bool { return r == ',' }}
+	checkSplits(t, comma, []splitCase{
+		{"a ,, b", []string{"a", "", "b"}}, // soft runs next to a hard rune collapse into it
+		{"a , b", []string{"a", "b"}},
+		{",a,", []string{"", "a", ""}},
+		{",,", []string{"", "", ""}},
+	})
+}
+
+func TestMaxQuoteSpan(t *testing.T) {
+	opts := SplitOptions{MaxQuoteSpan: 3}
+	checkSplits(t, opts, []splitCase{{`"abc" d`, []string{"abc", "d"}}})
+	var qse *QuoteSpanError
+	if _, err := ShellSplitWithOptions(`x "abcd"`, opts); !errors.As(err, &qse) || qse.Offset != 2 || qse.MaxSpan != 3 {
+		t.Errorf(`ShellSplitWithOptions("x \"abcd\"") error = %v, want a QuoteSpanError at 2`, err)
+	}
+}
+
+func TestDecodePercent(t *testing.T) {
+	opts := SplitOptions{DecodePercent: true}
+	checkSplits(t, opts, []splitCase{
+		{`a%20b "c%2Fd" 'e%20f'`, []string{"a b", "c/d", "e%20f"}}, // nothing is decoded in single quotes
+	})
+	var ee *EscapeError
+	if _, err := ShellSplitWithOptions("x %zz", opts); !errors.As(err, &ee) || ee.Offset != 2 {
+		t.Errorf(`ShellSplitWithOptions("x %%zz") error = %v, want an EscapeError at 2`, err)
+	}
+	checkSplits(t, SplitOptions{}, []splitCase{{"100% %20", []string{"100%", "%20"}}})
+}
+
+func TestTrimRunes(t *testing.T) {
+	checkSplits(t, SplitOptions{TrimRunes: "<>"}, []splitCase{
+		{"<a> <b>", []string{"a", "b"}},
+		{"<a a> <>", []string{"<a", "a>", ""}}, // left intact unless both runes are there
+		{`"<a b>"`, []string{"a b"}},           // after quote removal
+	})
+}
+
+func TestTokenRuneColumns(t *testing.T) {
+	tokens, err := ShellSplitTokens(`日本 x "é" y`, SplitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][4]int{{0, 6, 0, 2}, {7, 8, 3, 4}, {9, 13, 5, 8}, {14, 15, 9, 10}} // Start, End, StartRune, EndRune
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		if got := [4]int{tok.Start, tok.End, tok.StartRune, tok.EndRune}; got != want[i] {
+			t.Errorf("token %d %q at %v, want %v", i, tok.Value, got, want[i])
+		}
+	}
+}
+
+func TestStandardShellSpace(t *testing.T) {
+	const in = "a\vb\fc\td\ne"
+	checkSplits(t, SplitOptions{SplitFn: StandardShellSpace}, []splitCase{{in, []string{"a\vb\fc", "d", "e"}}})
+	checkSplits(t, SplitOptions{SplitFn: unicode.IsSpace}, []splitCase{{in, []string{"a", "b", "c", "d", "e"}}})
+}
+
+func TestUnicodeSeparator(t *testing.T) {
+	const in = "a\u2028b\u2029c\u3000d" // line and paragraph separators, ideographic space
+	checkSplits(t, SplitOptions{SplitFn: UnicodeSeparator}, []splitCase{{in, []string{"a", "b", "c", "d"}}})
+	checkSplits(t, SplitOptions{SplitFn: StandardShellSpace}, []splitCase{{in, []string{in}}})
+}
+
+func TestSplitOnEquals(t *testing.T) {
+	checkSplits(t, SplitOptions{SplitOnEquals: true}, []splitCase{
+		{`--opt=val "a=b"`, []string{"--opt", "val", "a=b"}}, // a quoted '=' is kept
+		{`c=d=e x=`, []string{"c", "d=e", "x", ""}},
+	})
+}
+
+func TestOpaqueSubstitution(t *testing.T) {
+	opts := SplitOptions{OpaqueSubstitution: true}
+	checkSplits(t, opts, []splitCase{{`echo $(ls "a b") <(x y)z`, []string{"echo", `$(ls "a b")`, "<(x y)z"}}})
+	var uqe *UnterminatedQuoteError
+	if _, err := ShellSplitWithOptions(`echo $(ls`, opts); !errors.As(err, &uqe) || uqe.Quote != '(' {
+		t.Errorf(`ShellSplitWithOptions("echo $(ls") error = %v, want an UnterminatedQuoteError for '('`, err)
+	}
+}
+
+func TestTokenAtOffset(t *testing.T) {
+	const in = `a "b c" d`
+	for _, tc := range []struct {
+		offset int
+		want   string // "" for no token
+	}{
+		{0, "a"},
+		{2, "b c"}, // on the opening quote
+		{4, "b c"}, // on the space inside the quotes
+		{7, ""},    // between tokens
+		{8, "d"},
+		{9, ""}, // past the end
+	} {
+		tok, err := TokenAtOffset(in, tc.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if tok != nil {
+			got = tok.Value
+		}
+		if got != tc.want {
+			t.Errorf("TokenAtOffset(%q, %d) = %q, want %q", in, tc.offset, got, tc.want)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		opts SplitOptions
+	}{
+		{"{a {b {c}}}", SplitOptions{BraceQuotes: true, MaxDepth: 2}},
+		{"$(a $(b $(c)))", SplitOptions{OpaqueSubstitution: true, MaxDepth: 2}},
+	} {
+		var de *DepthError
+		if _, err := ShellSplitWithOptions(tc.in, tc.opts); !errors.As(err, &de) || de.MaxDepth != 2 {
+			t.Errorf("ShellSplitWithOptions(%q) error = %v, want a DepthError", tc.in, err)
+		}
+	}
+	checkSplits(t, SplitOptions{BraceQuotes: true, MaxDepth: 2}, []splitCase{{"{a {b}}", []string{"a {b}"}}})
+}
+
+func TestKeepEscapes(t *testing.T) {
+	const in = `a\ b "c\"d"`
+	checkSplits(t, SplitOptions{}, []splitCase{{in, []string{`a\`, "b", `c\"d`}}})
+	checkSplits(t, SplitOptions{DecodeEscapes: true}, []splitCase{{in, []string{"a b", `c"d`}}})
+	checkSplits(t, SplitOptions{DecodeEscapes: true, KeepEscapes: true}, []splitCase{{in, []string{`a\ b`, `c\"d`}}})
+}
+
+func TestShellSplitNonEmpty(t *testing.T) {
+	if got, err := ShellSplitNonEmpty(`a b`, nil); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf(`ShellSplitNonEmpty("a b") = %q, %v`, got, err)
+	}
+	for _, in := range []string{`a "" b`, `''`} {
+		if got, err := ShellSplitNonEmpty(in, nil); err == nil {
+			t.Errorf("ShellSplitNonEmpty(%q) = %q; want an error", in, got)
+		}
+	}
+}
+
+func TestClassifyOperators(t *testing.T) {
+	type word struct {
+		value string
+		kind  TokenKind
+	}
+	for _, tc := range []struct {
+		in   string
+		want []word
+	}{
+		{`cat <in >out`, []word{
+			{"cat", TokenWord}, {"<", TokenOperator}, {"in", TokenWord}, {">", TokenOperator}, {"out", TokenWord},
+		}},
+		{`foo>bar`, []word{{"foo", TokenWord}, {">", TokenOperator}, {"bar", TokenWord}}},
+		{`cmd 2>&1`, []word{{"cmd", TokenWord}, {"2>&1", TokenOperator}}},
+		{`x2>y ">"`, []word{{"x2", TokenWord}, {">", TokenOperator}, {"y", TokenWord}, {">", TokenWord}}},
+	} {
+		tokens, err := ShellSplitTokens(tc.in, SplitOptions{ClassifyOperators: true})
+		if err != nil {
+			t.Fatalf("ShellSplitTokens(%q): %v", tc.in, err)
+		}
+		var got []word
+		for _, tok := range tokens {
+			got = append(got, word{tok.Value, tok.Kind})
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ShellSplitTokens(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestShellSplitJoined(t *testing.T) {
+	for _, sep := range []string{"\n", "|"} {
+		want := strings.Join([]string{"a", "b c", "d"}, sep)
+		if got, err := ShellSplitJoined(`a "b c" d`, nil, sep); err != nil || got != want {
+			t.Errorf("ShellSplitJoined with %q = %q, %v; want %q", sep, got, err, want)
+		}
+	}
+	if _, err := ShellSplitJoined(`"a`, nil, "|"); err == nil {
+		t.Error(`ShellSplitJoined("\"a") succeeded; want an error`)
+	}
+}
+
+func TestWarnQuoteMismatch(t *testing.T) {
+	opts := SplitOptions{WarnQuoteMismatch: true}
+	for _, tc := range []struct {
+		in   string
+		warn bool
+	}{
+		{`"a'b"`, true},
+		{`'a"b'`, true},
+		{`"say 'hi'"`, false},
+	} {
+		_, warnings, err := ShellSplitWithWarnings(tc.in, opts)
+		if err != nil || (len(warnings) > 0) != tc.warn {
+			t.Errorf("ShellSplitWithWarnings(%q) warnings = %q, %v; want a warning: %v", tc.in, warnings, err, tc.warn)
+		}
+	}
+}
+
+func TestLeadingSep(t *testing.T) {
+	tokens, err := ShellSplitTokens("a   b,c ,  d", SplitOptions{SplitFn: RuneSet(" ,")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.LeadingSep)
+	}
+	if want := []string{"", "   ", ",", " ,  "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LeadingSep = %q, want %q", got, want)
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	opts := SplitOptions{BlockComments: true}
+	checkSplits(t, opts, []splitCase{
+		{"a /* x y */ b", []string{"a", "b"}},
+		{"a/**/b", []string{"a", "b"}},
+		{`a "/*" b`, []string{"a", "/*", "b"}},
+	})
+	var uce *UnterminatedCommentError
+	if _, err := ShellSplitWithOptions("a /* x", opts); !errors.As(err, &uce) || uce.Offset != 2 {
+		t.Errorf(`ShellSplitWithOptions("a /* x") error = %v, want an UnterminatedCommentError at 2`, err)
+	}
+}
+
+func TestDefaultToken(t *testing.T) {
+	opts := SplitOptions{DefaultToken: "help"}
+	checkSplits(t, opts, []splitCase{
+		{"", []string{"help"}},
+		{"  ", []string{"help"}},
+		{"a", []string{"a"}},
+	})
+	checkSplits(t, SplitOptions{}, []splitCase{{"  ", nil}})
+
+	sp := NewSplitter(opts)
+	if got, err := sp.Split(" "); err != nil || !reflect.DeepEqual(got, []string{"help"}) {
+		t.Errorf(`Splitter.Split(" ") = %q, %v; want ["help"]`, got, err)
+	}
+	f, err := sp.SplitPooled(" ")
+	if err != nil || !reflect.DeepEqual(f.Tokens, []string{"help"}) {
+		t.Errorf(`Splitter.SplitPooled(" ") = %q, %v; want ["help"]`, f.Tokens, err)
+	}
+	f.Release()
+}
+
+func TestValidateUTF8(t *testing.T) {
+	// the first invalid byte fails the split, even with an InvalidUTF8 mode that would replace it
+	opts := SplitOptions{ValidateUTF8: true, InvalidUTF8: InvalidUTF8Replace}
+	var ee *EncodingError
+	_, err := ShellSplitWithOptions("a b \xff c \xfe", opts)
+	if !errors.As(err, &ee) || ee.Offset != 4 || ee.Byte != 0xff {
+		t.Errorf("error = %v, want an EncodingError for 0xff at 4", err)
+	}
+}
+
+func TestLiteralBackslashUnquoted(t *testing.T) {
+	checkSplits(t, SplitOptions{LiteralBackslashUnquoted: true}, []splitCase{
+		{`C:\path\to file`, []string{`C:\path\to`, "file"}},
+		{`a\"b c"`, []string{`a\b c`}},
+	})
+}
+
+func TestTrimRunesEnclosing(t *testing.T) {
+	checkSplits(t, SplitOptions{}, []splitCase{{`"a"b"c"`, []string{"abc"}}})
+	checkSplits(t, SplitOptions{TrimRunes: "<>"}, []splitCase{
+		{`<a>b<c>`, []string{"<a>b<c>"}}, // the pair does not enclose the token
+		{`<a<b>>`, []string{"a<b>"}},
+	})
+}
+
+func TestWarnConfusableQuotes(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		lint bool
+		want int // warnings
+	}{
+		{"a ” b", true, 1},
+		{"a ″ b", true, 1},
+		{"“x”", true, 2}, // without SmartQuotes, curly quotes are ordinary runes
+		{`"”"`, true, 0}, // only runes outside quotes are flagged
+		{"a ” b", false, 0},
+	} {
+		fields, warnings, err := ShellSplitWithWarnings(tc.in, SplitOptions{WarnConfusableQuotes: tc.lint})
+		if err != nil || len(warnings) != tc.want {
+			t.Errorf("ShellSplitWithWarnings(%q, WarnConfusableQuotes: %v) = %q, %q, %v; want %d warnings",
+				tc.in, tc.lint, fields, warnings, err, tc.want)
+		}
+	}
+}
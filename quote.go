@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NeedsQuoting reports whether s must be quoted to be read back as a single token by a shell: it is
+// empty or holds anything besides ASCII letters, digits and the characters @%+=:,./-_ (whitespace,
+// quotes, backslashes, shell metacharacters, non-ASCII runes, ...).
+func NeedsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if !isSafeUnquoted(s[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSafeUnquoted(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("@%+=:,./-_", c) >= 0
+}
+
+// ShellQuote quotes s so that it is read back as a single token by a shell (and by ShellSplit).
+// s is returned as is if NeedsQuoting reports it needs no quoting. Otherwise it is wrapped in single
+// quotes; an embedded single quote closes the quoting, is double-quoted and then reopens it, as in
+// 'it'"'"'s', which ShellSplit reads back unchanged (unlike a backslash-escaped quote, whose
+// backslash it keeps).
+// A single scan of s decides both, and sizes the result so it is built with one allocation.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe, quotes := true, 0
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '\'' {
+			quotes++
+			safe = false
+		} else if safe && !isSafeUnquoted(c) {
+			safe = false
+		}
+	}
+	if safe {
+		return s
+	}
+	var sb strings.Builder
+	sb.Grow(len(s) + 2 + 4*quotes)
+	sb.WriteByte('\'')
+	for rest := s; ; {
+		i := strings.IndexByte(rest, '\'')
+		if i < 0 {
+			sb.WriteString(rest)
+			break
+		}
+		sb.WriteString(rest[:i])
+		sb.WriteString(`'"'"'`)
+		rest = rest[i+1:]
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+// ShellJoin is the reverse of ShellSplit: it quotes each field with ShellQuote and joins them with spaces,
+// so ShellSplit(ShellJoin(fields)) gives back fields for any fields that are valid UTF-8.
+func ShellJoin(fields []string) string {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = ShellQuote(f)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Canonicalize rewrites the command line s in a canonical form, for comparing or caching command
+// lines: it is split with escapes decoded and joined again with ShellJoin's minimal quoting, so
+// equivalent spellings such as 'a b', "a b" and a\ b all give the same result.
+func Canonicalize(s string) (string, error) {
+	fields, err := ShellSplitWithOptions(s, SplitOptions{DecodeEscapes: true})
+	if err != nil {
+		return "", WrapTraceableErrorf(err, "failed to canonicalize %q", s)
+	}
+	return ShellJoin(fields), nil
+}
+
+// SafeString renders token for logs and error messages with its non-printable runes, invalid bytes,
+// backslashes and double quotes escaped as Go's %q would, but without the surrounding quotes, so
+// control characters such as ESC or a newline cannot garble a terminal or split a log line.
+func SafeString(token string) string {
+	q := strconv.Quote(token)
+	return q[1 : len(q)-1]
+}
+
+// ReplaceToken returns the command line s with its token at index, split like ShellSplit, replaced
+// by newValue quoted with ShellQuote. The rest of s, other tokens and spacing included, is kept as
+// written. An index out of range is an error.
+func ReplaceToken(s string, index int, newValue string) (string, error) {
+	tokens, err := ShellSplitTokens(s, SplitOptions{})
+	if err != nil {
+		return "", WrapTraceableErrorf(err, "failed to replace token %d of %q", index, s)
+	}
+	if index < 0 || index >= len(tokens) {
+		return "", WrapTraceableErrorf(nil, "failed to replace token %d of %q: it has %d tokens", index, s, len(tokens))
+	}
+	t := tokens[index]
+	return s[:t.Start] + ShellQuote(newValue) + s[t.End:], nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNeedsQuoting(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want bool
+	}{
+		{"plain", false},
+		{"/usr/bin/x-1.0,a=b@c%d+e:f_g", false},
+		{"", true},
+		{"a b", true},
+		{"tab\there", true},
+		{"a;b", true},
+		{"a|b", true},
+		{"$HOME", true},
+		{"it's", true},
+		{"é", true},
+	} {
+		if got := NeedsQuoting(tc.in); got != tc.want {
+			t.Errorf("NeedsQuoting(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"", "''"},
+		{"plain", "plain"},
+		{"a b", "'a b'"},
+		{"it's", `'it'"'"'s'`},
+		{`say "hi"`, `'say "hi"'`},
+		{"a\nb", "'a\nb'"},
+	} {
+		if got := ShellQuote(tc.in); got != tc.want {
+			t.Errorf("ShellQuote(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+var realisticArgv = []string{
+	"docker", "run", "--rm", "-e", "GREETING=hello world", "-v", "/home/user/src:/src",
+	"--name", "build-1", "golang:1.23", "sh", "-c", "cd /src && go test ./... 2>&1 | tee 'test output.log'",
+}
+
+func TestShellQuoteRoundTrip(t *testing.T) {
+	for _, s := range append([]string{"", "plain", "a b", "it's", `"`, "tab\there", "日本 語", "x=$HOME"},
+		realisticArgv...) {
+		got, err := ShellSplit(ShellQuote(s))
+		if err != nil || !reflect.DeepEqual(got, []string{s}) {
+			t.Errorf("ShellSplit(ShellQuote(%q)) = %q, %v", s, got, err)
+		}
+	}
+	if got := ShellQuote("plain-word_1.0/x"); got != "plain-word_1.0/x" {
+		t.Errorf("ShellQuote quoted a safe word: %s", got)
+	}
+}
+
+func BenchmarkShellJoin(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ShellJoin(realisticArgv)
+	}
+}
+
+func BenchmarkShellQuote(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, s := range realisticArgv {
+			ShellQuote(s)
+		}
+	}
+}
+
+// FuzzShellJoinRoundTrip checks that ShellSplit(ShellJoin(fields)) is fields. The fields are the
+// fuzzed string cut at each U+001F (unit separator).
+func FuzzShellJoinRoundTrip(f *testing.F) {
+	// ShellQuote used to escape an embedded single quote with a backslash, which ShellSplit keeps
+	for _, seed := range []string{"", "'", `"'"`, "\n", "it's", "a\x1f\x1fb", " \x1f\t", `\`, `'\''`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		if !utf8.ValidString(data) {
+			t.Skip()
+		}
+		fields := strings.Split(data, "\x1f")
+		joined := ShellJoin(fields)
+		got, err := ShellSplit(joined)
+		if err != nil || !reflect.DeepEqual(got, fields) {
+			t.Errorf("ShellSplit(ShellJoin(%q)) = %q, %v (joined: %s)", fields, got, err, joined)
+		}
+	})
+}
+
+func TestCanonicalize(t *testing.T) {
+	for _, in := range []string{`'a b'`, `"a b"`, `a\ b`} {
+		if got, err := Canonicalize(in); err != nil || got != "'a b'" {
+			t.Errorf("Canonicalize(%q) = %q, %v; want %q", in, got, err, "'a b'")
+		}
+	}
+}
+
+func TestSafeString(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"a\x1b[31mb", `a\x1b[31mb`},
+		{"line\nnext", `line\nnext`},
+		{`say "hi" \ é`, `say \"hi\" \\ é`},
+		{"\xff", `\xff`},
+	} {
+		if got := SafeString(tc.in); got != tc.want {
+			t.Errorf("SafeString(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestReplaceToken(t *testing.T) {
+	if got, err := ReplaceToken(`a "b c" d`, 1, "x y"); err != nil || got != `a 'x y' d` {
+		t.Errorf("ReplaceToken = %q, %v; want %q", got, err, `a 'x y' d`)
+	}
+	for _, i := range []int{3, -1} {
+		if _, err := ReplaceToken(`a "b c" d`, i, "x"); err == nil {
+			t.Errorf("ReplaceToken at %d succeeded; want an error", i)
+		}
+	}
+}
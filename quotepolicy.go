@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// QuotePolicy turns a quoted segment into the text it contributes to its token, for dialects that strip
+// quotes differently from the built-in rules. The scanner still decides where a segment ends; raw is the
+// segment as written, opened by quote and closed by its matching quote, both included (as UTF-8, even
+// when FallbackCP1252 decoded them from single bytes).
+type QuotePolicy interface {
+	StripAndDecode(raw string, quote rune) (string, error)
+}
+
+// POSIXQuotePolicy strips quotes like a POSIX shell: nothing is special inside single quotes, and inside
+// double quotes a backslash only escapes $, `, ", \ and newline (an escaped newline is removed); any other
+// backslash is kept.
+type POSIXQuotePolicy struct{}
+
+func (POSIXQuotePolicy) StripAndDecode(raw string, quote rune) (string, error) {
+	inner := stripQuotes(raw, quote)
+	if quote != '"' || strings.IndexByte(inner, '\\') < 0 {
+		return inner, nil
+	}
+	var sb strings.Builder
+	sb.Grow(len(inner))
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		if c == '\\' && i+1 < len(inner) && strings.IndexByte("$`\"\\\n", inner[i+1]) >= 0 {
+			if i++; inner[i] == '\n' { // line continuation
+				continue
+			}
+			c = inner[i]
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String(), nil
+}
+
+// RawQuotePolicy keeps quoted segments as written, outer quotes included.
+type RawQuotePolicy struct{}
+
+func (RawQuotePolicy) StripAndDecode(raw string, quote rune) (string, error) {
+	return raw, nil
+}
+
+// stripQuotes removes the quote opening raw and the quote closing it.
+func stripQuotes(raw string, quote rune) string {
+	return raw[utf8.RuneLen(quote) : len(raw)-utf8.RuneLen(closingQuote(quote))]
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// upperQuotePolicy strips quotes like the built-in rules for plain text, but uppercases the segment.
+type upperQuotePolicy struct{}
+
+func (upperQuotePolicy) StripAndDecode(raw string, quote rune) (string, error) {
+	return strings.ToUpper(stripQuotes(raw, quote)), nil
+}
+
+func TestCustomQuotePolicy(t *testing.T) {
+	checkSplits(t, SplitOptions{QuotePolicy: upperQuotePolicy{}}, []splitCase{
+		{`a "b c" 'd'e`, []string{"a", "B C", "De"}}, // only the quoted segments go through the policy
+	})
+}
+
+func TestQuotePolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy QuotePolicy
+		raw    string
+		quote  rune
+		want   string
+	}{
+		{POSIXQuotePolicy{}, `"a\$b\x\"c"`, '"', `a$b\x"c`}, // \x is not an escape in double quotes
+		{POSIXQuotePolicy{}, "\"a\\\nb\"", '"', "ab"},       // line continuation
+		{POSIXQuotePolicy{}, `'a\$b'`, '\'', `a\$b`},
+		{RawQuotePolicy{}, `"a b"`, '"', `"a b"`},
+	} {
+		if got, err := tc.policy.StripAndDecode(tc.raw, tc.quote); err != nil || got != tc.want {
+			t.Errorf("%T.StripAndDecode(%q) = %q, %v; want %q", tc.policy, tc.raw, got, err, tc.want)
+		}
+	}
+}
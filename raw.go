@@ -0,0 +1,33 @@
+package main
+
+// rawSplitOptions are the options SplitRaw tokenizes with and Decode decodes with.
+var rawSplitOptions = SplitOptions{DecodeEscapes: true}
+
+// SplitRaw is the first phase of a two-phase split: it splits s on whitespace but returns each token
+// as written, quotes and escapes intact, e.g. for logging. Decode performs the second phase.
+func SplitRaw(s string) ([]string, error) {
+	tokens, err := ShellSplitTokens(s, rawSplitOptions)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		return nil, nil
+	}
+	raw := make([]string, len(tokens))
+	for i, t := range tokens {
+		raw[i] = t.Raw
+	}
+	return raw, nil
+}
+
+// Decode is the second phase of a two-phase split: it removes the quotes of a token returned by
+// SplitRaw and decodes its escape sequences. Split runes in token are kept as is.
+func Decode(token string) (string, error) {
+	opts := rawSplitOptions
+	opts.SplitFn = func(rune) bool { return false }
+	sc := newScanner([]byte(token), &opts)
+	if _, _, err := sc.next(); err != nil {
+		return "", WrapTraceableErrorf(err, "failed to decode token %q", token)
+	}
+	return string(sc.tok), nil
+}
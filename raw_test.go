@@ -0,0 +1,16 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitRawThenDecode(t *testing.T) {
+	raw, err := SplitRaw(`a "b c"`)
+	if want := []string{"a", `"b c"`}; err != nil || !reflect.DeepEqual(raw, want) {
+		t.Fatalf(`SplitRaw("a \"b c\"") = %q, %v; want %q`, raw, err, want)
+	}
+	if got, err := Decode(raw[1]); err != nil || got != "b c" {
+		t.Errorf("Decode(%q) = %q, %v; want %q", raw[1], got, err, "b c")
+	}
+}
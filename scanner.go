@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scanner carves tokens out of b one rune at a time. Its methods are the helpers ShellSplitEx used to
+// define as closures; the state they shared lives in the struct.
+//
+// Splitting is O(n) in the length of the input: every byte is decoded a bounded number of times
+// (skipSplitCh stops at the first rune of a token, which findSplitCh decodes again) and never revisited
+// after, except when LenientQuotes rescans an unterminated quoted segment once. That scan also notes the
+// openers of the same kind it met and left unclosed, so a later one fails at once instead of scanning to
+// the end again. Allocations are one string per token plus the amortized growth of the token buffer and
+// of the result slice.
+type scanner struct {
+	b       []byte
+	src     string // b as a string, if it was given as one, to take tokens from without copying
+	l       int
+	idx     int // next rune index
+	start   int // index of the current token
+	opts    *SplitOptions
+	splitFn func(rune) bool
+	ascii   [utf8.RuneSelf]bool // splitFn of each ASCII rune, computed once with CacheASCII
+	tok     []byte              // current token with the quotes of its quoted segments removed
+	quoted  bool                // current token has a quoted segment
+	decoded bool                // current token had an escape sequence decoded
+
+	operator     bool      // current token is a redirection operator (ClassifyOperators)
+	validated    bool      // the input was checked with ValidateUTF8
+	wantSegments bool      // record the quoted segments of each token
+	segments     []Segment // quoted segments of the current token, if wantSegments
+
+	nested   []int        // openers met, and so far left unclosed, by the quoted segment scan under way
+	unclosed map[int]bool // openers known to have no closing quote, with LenientQuotes
+
+	tokenState
+
+	warnings []string // recoverable anomalies met so far
+	stats    Stats
+}
+
+// tokenState is the state the scanner carries from one token to the next.
+type tokenState struct {
+	fieldDone bool // a token was produced since the last hard split rune
+	sawHard   bool // a hard split rune was met
+	atEquals  bool // the last token ended at an '=' split off by SplitOnEquals
+}
+
+func newScanner(b []byte, opts *SplitOptions) *scanner {
+	sc := &scanner{}
+	sc.reset(b, opts)
+	return sc
+}
+
+// reset readies sc to scan b as configured by opts, keeping only its token buffer.
+func (sc *scanner) reset(b []byte, opts *SplitOptions) {
+	splitFn := opts.SplitFn
+	if splitFn == nil {
+		splitFn = defaultSplitFn
+	}
+	*sc = scanner{b: b, l: len(b), opts: opts, splitFn: splitFn, tok: sc.tok[:0]}
+	if opts.CacheASCII {
+		for r := range sc.ascii {
+			sc.ascii[r] = splitFn(rune(r))
+		}
+	}
+}
+
+// isSplit reports whether r is a split rune, looking ASCII runes up in the CacheASCII table if there is one.
+func (sc *scanner) isSplit(r rune) bool {
+	if sc.opts.CacheASCII && r < utf8.RuneSelf {
+		return sc.ascii[r]
+	}
+	return sc.splitFn(r)
+}
+
+// decodeRune decodes the rune at idx; what describes the caller for the error message.
+func (sc *scanner) decodeRune(what string) (rune, int, error) {
+	r, s := utf8.DecodeRune(sc.b[sc.idx:])
+	if r == utf8.RuneError && s == 1 && sc.opts.FallbackCP1252 {
+		r = decodeCP1252(sc.b[sc.idx])
+	}
+	if r == utf8.RuneError && s == 1 && sc.opts.InvalidUTF8 == InvalidUTF8Error { // invalid Unicode encoding
+		return r, s, WrapTraceableErrorf(&EncodingError{Offset: sc.idx, Byte: sc.b[sc.idx], context: sc.context(sc.idx)},
+			"failed to %s", what)
+	}
+	if sc.opts.NormalizeSpace && r >= utf8.RuneSelf && (unicode.IsSpace(r) || unicode.Is(unicode.Zs, r)) {
+		return ' ', s, nil
+	}
+	return r, s, nil
+}
+
+// validate returns an EncodingError for the first invalid UTF-8 byte of the input, if there is one.
+func (sc *scanner) validate() error {
+	if utf8.Valid(sc.b) {
+		return nil
+	}
+	for i := 0; i < sc.l; {
+		r, s := utf8.DecodeRune(sc.b[i:])
+		if r == utf8.RuneError && s == 1 {
+			return WrapTraceableErrorf(&EncodingError{Offset: i, Byte: sc.b[i], context: sc.context(i)},
+				"failed to validate input")
+		}
+		i += s
+	}
+	return nil
+}
+
+// maxErrorContext is how many bytes of the input before an error are quoted in its message. Bounding it
+// keeps an error on a long input from copying everything before it (once per wrapping level).
+const maxErrorContext = 32
+
+// context returns the end of the input before index i, for error messages, made safe by SafeString.
+func (sc *scanner) context(i int) string {
+	if i <= maxErrorContext {
+		return SafeString(string(sc.b[:i]))
+	}
+	start := i - maxErrorContext
+	for start < i && !utf8.RuneStart(sc.b[start]) { // don't start in the middle of a rune
+		start++
+	}
+	return "..." + SafeString(string(sc.b[start:i]))
+}
+
+// trace reports event at index pos to TraceFunc, if there is one.
+func (sc *scanner) trace(event string, pos int) {
+	if sc.opts.TraceFunc != nil {
+		sc.opts.TraceFunc(event, pos)
+	}
+}
+
+// warn records a recoverable anomaly, reported by ShellSplitWithWarnings.
+func (sc *scanner) warn(format string, args ...interface{}) {
+	sc.warnings = append(sc.warnings, fmt.Sprintf(format, args...))
+}
+
+// appendRune appends the rune r of s bytes at idx to tok and moves past it. A rune that NormalizeSpace
+// turned into a space is appended as a space rather than as its original bytes.
+// An invalid byte decoded by FallbackCP1252 is appended as the rune it stands for, and one let through
+// by InvalidUTF8 as U+FFFD or not at all.
+func (sc *scanner) appendRune(r rune, s int) {
+	switch {
+	case r == ' ' && sc.b[sc.idx] != ' ':
+		sc.tok = append(sc.tok, ' ')
+	case s == 1 && r >= utf8.RuneSelf && r != utf8.RuneError:
+		sc.tok = utf8.AppendRune(sc.tok, r)
+	case r == utf8.RuneError && s == 1:
+		if sc.opts.InvalidUTF8 == InvalidUTF8Replace {
+			sc.tok = utf8.AppendRune(sc.tok, utf8.RuneError)
+			sc.warn("invalid Unicode encoding byte 0x%02x at index %d replaced with U+FFFD", sc.b[sc.idx], sc.idx)
+		} else {
+			sc.warn("invalid Unicode encoding byte 0x%02x at index %d dropped", sc.b[sc.idx], sc.idx)
+		}
+	default:
+		sc.tok = append(sc.tok, sc.b[sc.idx:sc.idx+s]...)
+	}
+	sc.idx += s
+}
+
+// next scans the next token into tok and returns its start index; ok is false at the end of the input.
+func (sc *scanner) next() (start int, ok bool, err error) {
+	if sc.opts.ValidateUTF8 && !sc.validated {
+		sc.validated = true
+		if err := sc.validate(); err != nil {
+			return 0, false, err
+		}
+	}
+	for sc.idx < sc.l {
+		afterEquals := sc.atEquals
+		sc.atEquals = false
+		if afterEquals { // what follows a split '=' is a token of its own, even if it is empty
+			sc.idx++
+		} else if err := sc.skipSplitCh(); err != nil {
+			return 0, false, err
+		}
+		start = sc.idx
+		sc.start = start
+		sc.tok = sc.tok[:0]
+		sc.quoted, sc.decoded, sc.operator, sc.segments = false, false, false, nil
+		if sc.idx < sc.l && !afterEquals {
+			if r, s := utf8.DecodeRune(sc.b[sc.idx:]); sc.isHardSplit(r) {
+				if !sc.fieldDone { // nothing but soft split runes since the last hard one: an empty field
+					sc.fieldDone = true
+					sc.trace(TraceToken, start)
+					return start, true, nil
+				}
+				sc.idx += s
+				sc.fieldDone, sc.sawHard = false, true
+				continue
+			}
+		}
+		if err := sc.findSplitCh(!afterEquals); err != nil {
+			return 0, false, err
+		}
+		if start < sc.idx || afterEquals || sc.atEquals {
+			// quoted segments are concatenated with their neighbors, so a""b is ab and "" is an empty token
+			sc.fieldDone = true
+			sc.trace(TraceToken, start)
+			return start, true, nil
+		}
+	}
+	if sc.sawHard && !sc.fieldDone { // the input ends with a hard split rune: an empty last field
+		sc.fieldDone = true
+		sc.start, sc.tok = sc.idx, sc.tok[:0]
+		sc.quoted, sc.decoded, sc.operator, sc.segments = false, false, false, nil
+		sc.trace(TraceToken, sc.idx)
+		return sc.idx, true, nil
+	}
+	return 0, false, nil
+}
+
+// isHardSplit reports whether r is a hard split rune (see SplitOptions.HardSplitFn).
+func (sc *scanner) isHardSplit(r rune) bool {
+	return sc.opts.HardSplitFn != nil && !sc.isQuote(r) && sc.opts.HardSplitFn(r)
+}
+
+// value returns the token just scanned by next, passed through TokenFunc if one is set.
+func (sc *scanner) value(start int) (string, error) {
+	v := ""
+	if raw := sc.b[start:sc.idx]; sc.src != "" && bytes.Equal(raw, sc.tok) { // no need for a copy
+		v = sc.src[start:sc.idx]
+	} else {
+		v = string(sc.tok)
+	}
+	if sc.opts.TrimRunes != "" {
+		v = trimPair(v, sc.opts.TrimRunes)
+	}
+	if sc.opts.TokenFunc == nil {
+		return v, nil
+	}
+	nv, err := sc.opts.TokenFunc(v)
+	if err != nil {
+		return "", WrapTraceableErrorf(err, "failed to process token %q at index %d", v, start)
+	}
+	return nv, nil
+}
+
+// trimPair removes the first pair of pairs whose opening and closing runes surround v.
+func trimPair(v string, pairs string) string {
+	for len(pairs) > 0 {
+		open, n := utf8.DecodeRuneInString(pairs)
+		closing, m := utf8.DecodeRuneInString(pairs[n:])
+		if m == 0 { // odd rune out
+			break
+		}
+		pairs = pairs[n+m:]
+		if first, fs := utf8.DecodeRuneInString(v); first == open && len(v) > fs && encloses(v, open, closing) {
+			return v[fs : len(v)-utf8.RuneLen(closing)]
+		}
+	}
+	return v
+}
+
+// encloses reports whether the open rune starting v is matched by the closing rune ending it rather than
+// by an earlier one, so that `"a"b"c"` is not trimmed to `a"b"c`. Pairs of distinct runes nest.
+func encloses(v string, open, closing rune) bool {
+	depth := 0
+	for i, r := range v {
+		switch {
+		case r == closing && i > 0:
+			if depth--; depth == 0 {
+				return i+utf8.RuneLen(closing) == len(v)
+			}
+		case r == open:
+			depth++
+		}
+	}
+	return false
+}
+
+func (sc *scanner) skipSplitCh() error { // skip spaces
+	for sc.idx < sc.l {
+		r, s, err := sc.decodeRune("skip spaces")
+		if err != nil {
+			return err
+		}
+		if r == utf8.RuneError && s == 1 && sc.opts.InvalidUTF8 == InvalidUTF8Skip { // skipped like a space
+			sc.warn("invalid Unicode encoding byte 0x%02x at index %d dropped", sc.b[sc.idx], sc.idx)
+			sc.idx += s
+			continue
+		}
+		if sc.atBlockComment() { // skipped like a space
+			end := bytes.Index(sc.b[sc.idx+2:], []byte("*/"))
+			if end < 0 {
+				return WrapTraceableErrorf(&UnterminatedCommentError{Offset: sc.idx}, "failed to skip block comment (%s)",
+					sc.context(sc.idx))
+			}
+			sc.idx += 2 + end + 2
+			continue
+		}
+		if sc.isQuote(r) || !sc.isSplit(r) || sc.isHardSplit(r) { // done, stop at the non-split rune
+			break
+		}
+		sc.idx += s
+	}
+	// end of string
+	return nil
+}
+
+// atBlockComment reports whether a block comment starts at idx.
+func (sc *scanner) atBlockComment() bool {
+	return sc.opts.BlockComments && bytes.HasPrefix(sc.b[sc.idx:], []byte("/*"))
+}
+
+// findEndQuote finds the quote closing the one opened by q at index open and returns its index.
+func (sc *scanner) findEndQuote(q rune, open int) (int, error) {
+	closing := closingQuote(q)
+	literal := q == '\'' || q == '\u2018' // like in a POSIX shell, nothing is special inside single quotes
+	for span := 0; sc.idx < sc.l; span++ {
+		if err := sc.checkQuoteSpan(span, open, q); err != nil {
+			return 0, err
+		}
+		r, s, err := sc.decodeRune("find end matching quote")
+		if err != nil {
+			return 0, err
+		}
+		switch r {
+		case closing: // found it
+			end := sc.idx
+			sc.idx += s
+			return end, nil
+		case '\\': // escape looks ahead rather than back, so a backslash right after the opening quote is no different
+			if literal {
+				sc.appendRune(r, s)
+			} else if err := sc.escape(); err != nil {
+				return 0, err
+			}
+		case '%':
+			if literal {
+				sc.appendRune(r, s)
+			} else if err := sc.percent(); err != nil {
+				return 0, err
+			}
+		default:
+			if r == q && sc.opts.LenientQuotes { // only a smart quote opens with a rune that does not close it
+				sc.nested = append(sc.nested, sc.idx)
+			}
+			sc.appendRune(r, s)
+		}
+	}
+	// end of string
+	return 0, &UnterminatedQuoteError{Offset: open, Quote: q}
+}
+
+// checkQuoteSpan fails once the quoted segment opened by q at index open holds more than MaxQuoteSpan runes.
+func (sc *scanner) checkQuoteSpan(span, open int, q rune) error {
+	if sc.opts.MaxQuoteSpan > 0 && span > sc.opts.MaxQuoteSpan {
+		return &QuoteSpanError{Offset: open, Quote: q, MaxSpan: sc.opts.MaxQuoteSpan}
+	}
+	return nil
+}
+
+// tooDeep reports whether depth levels of nesting exceed MaxDepth.
+func (sc *scanner) tooDeep(depth int) bool {
+	return sc.opts.MaxDepth > 0 && depth > sc.opts.MaxDepth
+}
+
+// findEndBrace finds the brace closing the one opened at index open, Tcl style: braces nest and only the
+// outermost pair is removed, backslashes are kept along with the rune they escape (so an escaped brace
+// does not nest), and a backslash-newline plus the blanks after it stands for a single space. It returns
+// the index of the closing brace.
+func (sc *scanner) findEndBrace(open int) (int, error) {
+	depth := 1
+	for span := 0; sc.idx < sc.l; span++ {
+		if err := sc.checkQuoteSpan(span, open, '{'); err != nil {
+			return 0, err
+		}
+		r, s, err := sc.decodeRune("find end matching brace")
+		if err != nil {
+			return 0, err
+		}
+		switch r {
+		case '{':
+			if depth++; sc.tooDeep(depth) {
+				return 0, &DepthError{Offset: sc.idx, MaxDepth: sc.opts.MaxDepth}
+			}
+			if sc.opts.LenientQuotes {
+				sc.nested = append(sc.nested, sc.idx)
+			}
+		case '}':
+			if depth--; depth == 0 { // found it
+				end := sc.idx
+				sc.idx += s
+				return end, nil
+			}
+			if n := len(sc.nested); n > 0 {
+				sc.nested = sc.nested[:n-1]
+			}
+		case '\\':
+			if sc.idx+1 < sc.l && sc.b[sc.idx+1] == '\n' {
+				sc.idx += 2
+				for sc.idx < sc.l && (sc.b[sc.idx] == ' ' || sc.b[sc.idx] == '\t') {
+					sc.idx++
+				}
+				sc.tok = append(sc.tok, ' ')
+				continue
+			}
+			// keep the backslash and the rune it escapes as is, so an escaped brace does not nest
+			sc.appendRune(r, s)
+			if sc.idx == sc.l {
+				continue
+			}
+			if r, s, err = sc.decodeRune("find end matching brace"); err != nil {
+				return 0, err
+			}
+		}
+		sc.appendRune(r, s)
+	}
+	// end of string
+	return 0, &UnterminatedQuoteError{Offset: open, Quote: '{'}
+}
+
+// findSplitCh finds the next space to split; with equals, an '=' splits too if SplitOnEquals is set.
+func (sc *scanner) findSplitCh(equals bool) error {
+	for sc.idx < sc.l {
+		r, s, err := sc.decodeRune("find next space")
+		if err != nil {
+			return err
+		}
+		if !sc.isQuote(r) && sc.isSplit(r) || sc.isHardSplit(r) { // found it
+			return nil
+		}
+		if r == '=' && equals && sc.opts.SplitOnEquals { // stop at it; next moves past it
+			sc.atEquals = true
+			return nil
+		}
+		if sc.atBlockComment() { // a comment ends the token; skipSplitCh skips it
+			return nil
+		}
+		switch {
+		case r == '\\' && sc.opts.LiteralBackslashUnquoted:
+			sc.appendRune(r, s)
+		case r == '\\':
+			if err := sc.escape(); err != nil {
+				return err
+			}
+		case r == '%':
+			if err := sc.percent(); err != nil {
+				return err
+			}
+		case (r == '$' || r == '<') && sc.opts.OpaqueSubstitution && sc.idx+1 < sc.l && sc.b[sc.idx+1] == '(':
+			open := sc.idx
+			if err := sc.findEndParen(); err != nil {
+				return WrapTraceableErrorf(err, "failed to find the end of the substitution starting at index %d (%s)",
+					open, sc.context(open))
+			}
+		case (r == '<' || r == '>') && sc.opts.ClassifyOperators:
+			if sc.allDigits() { // the operator, with the file descriptor before it
+				sc.redirection()
+			}
+			return nil // the operator ends the word before it
+		case sc.isQuote(r) && (r != '{' || sc.idx == sc.start): // quote; a brace only quotes at the start of a token
+			// the quotes themselves are not part of the token
+			open, n, w, decoded, escapes := sc.idx, len(sc.tok), len(sc.warnings), sc.decoded, sc.stats.Escapes
+			sc.trace(TraceQuoteOpen, open)
+			sc.idx += s
+			// the text then runs from start to the closing quote at end; FallbackCP1252 may decode either
+			// quote from a single byte, so their widths are not those of the runes
+			start, end := sc.idx, 0
+			sc.nested = sc.nested[:0]
+			switch {
+			case sc.unclosed[open]: // an earlier scan went past this quote and found nothing closing it
+				err = &UnterminatedQuoteError{Offset: open, Quote: r}
+			case r == '{':
+				end, err = sc.findEndBrace(open)
+			default:
+				end, err = sc.findEndQuote(r, open)
+			}
+			if err != nil { // find the matching end quote
+				var uqe *UnterminatedQuoteError
+				if sc.opts.LenientQuotes && errors.As(err, &uqe) {
+					// take the quote literally and carry on right after it
+					sc.warnings, sc.decoded, sc.stats.Escapes = sc.warnings[:w], decoded, escapes
+					sc.warn("unterminated quote (%c) at index %d taken literally", r, open)
+					if len(sc.nested) > 0 && sc.unclosed == nil {
+						sc.unclosed = make(map[int]bool, len(sc.nested))
+					}
+					for _, i := range sc.nested {
+						sc.unclosed[i] = true
+					}
+					sc.tok = append(sc.tok[:n], sc.b[open:start]...)
+					sc.idx = start
+					continue
+				}
+				var ee *EscapeError
+				if errors.As(err, &ee) {
+					return WrapTraceableErrorf(err, "failed to decode the quoted segment starting at index %d (%s)",
+						open, sc.context(open))
+				}
+				return WrapTraceableErrorf(err, "failed to find the matching quote starting at index %d (%s)",
+					open, sc.context(open))
+			}
+			if sc.opts.QuotePolicy != nil {
+				v, err := sc.opts.QuotePolicy.StripAndDecode(sc.quotedSegment(r, open, start, end), r)
+				if err != nil {
+					return WrapTraceableErrorf(err, "failed to decode the quoted segment at index %d (%s)",
+						open, sc.context(open))
+				}
+				sc.tok = append(sc.tok[:n], v...)
+			}
+			if sc.opts.WarnQuoteMismatch {
+				sc.checkQuoteMismatch(r, open, start)
+			}
+			sc.trace(TraceQuoteClose, end)
+			if sc.wantSegments {
+				sc.segments = append(sc.segments, Segment{Quote: r, Start: open, End: sc.idx,
+					RawInner: string(sc.b[start:end]), DecodedInner: string(sc.tok[n:])})
+			}
+			sc.quoted = true
+			sc.stats.QuotedRegions++
+		default:
+			if sc.opts.WarnConfusableQuotes && isConfusableQuote(r) {
+				sc.warn("rune %U (%c) at index %d looks like a quote but is taken literally", r, r, sc.idx)
+			}
+			sc.appendRune(r, s)
+		}
+	}
+	// end of string
+	return nil
+}
+
+// quotedSegment returns the segment quoted by q from index open, with its text from index start to the
+// closing quote at index end, for QuotePolicy: quotes FallbackCP1252 decoded from a single byte are
+// written as UTF-8, so the policy can strip them by their rune length.
+func (sc *scanner) quotedSegment(q rune, open, start, end int) string {
+	closing := closingQuote(q)
+	if start-open == utf8.RuneLen(q) && sc.idx-end == utf8.RuneLen(closing) {
+		return string(sc.b[open:sc.idx])
+	}
+	return string(q) + string(sc.b[start:end]) + string(closing)
+}
+
+// findEndParen copies the $(...) or <(...) substitution at idx into tok as is, up to its balanced closing
+// parenthesis. Parentheses in quotes don't count: single quotes are literal, and in double quotes and
+// outside quotes a backslash escapes the rune after it.
+func (sc *scanner) findEndParen() error {
+	open := sc.idx
+	depth, quote := 0, rune(0)
+	for sc.idx < sc.l {
+		r, s, err := sc.decodeRune("find end of substitution")
+		if err != nil {
+			return err
+		}
+		sc.idx += s
+		switch {
+		case r == '\\' && quote != '\'':
+			if sc.idx < sc.l {
+				_, s, err = sc.decodeRune("find end of substitution")
+				if err != nil {
+					return err
+				}
+				sc.idx += s
+			}
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			if depth++; sc.tooDeep(depth) {
+				return &DepthError{Offset: sc.idx - s, MaxDepth: sc.opts.MaxDepth}
+			}
+		case r == ')':
+			if depth--; depth == 0 { // found it
+				sc.tok = append(sc.tok, sc.b[open:sc.idx]...)
+				return nil
+			}
+		}
+	}
+	// end of string
+	return &UnterminatedQuoteError{Offset: open, Quote: '('}
+}
+
+// allDigits reports whether the current token so far is made of nothing but ASCII digits, if anything.
+func (sc *scanner) allDigits() bool {
+	for _, c := range sc.b[sc.start:sc.idx] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// redirection consumes the redirection operator at idx: <, >, <<, >> or <>, optionally followed by &
+// and a file descriptor or '-' (as in 2>&1 and >&-).
+func (sc *scanner) redirection() {
+	end := sc.idx + 1
+	if end < sc.l && (sc.b[end] == sc.b[sc.idx] || sc.b[sc.idx] == '<' && sc.b[end] == '>') {
+		end++
+	}
+	if end < sc.l && sc.b[end] == '&' {
+		if end+1 < sc.l && sc.b[end+1] == '-' {
+			end += 2
+		} else {
+			for end++; end < sc.l && '0' <= sc.b[end] && sc.b[end] <= '9'; end++ {
+			}
+		}
+	}
+	sc.tok = append(sc.tok, sc.b[sc.idx:end]...)
+	sc.idx = end
+	sc.operator = true
+}
+
+// checkQuoteMismatch warns if the segment quoted by q from index open, with its text starting at index
+// start, holds an odd number of the other ASCII quote, which suggests that quote was meant to close it.
+func (sc *scanner) checkQuoteMismatch(q rune, open, start int) {
+	other := byte('\'')
+	switch q {
+	case '\'':
+		other = '"'
+	case '"':
+	default:
+		return
+	}
+	if n := bytes.Count(sc.b[start:sc.idx-1], []byte{other}); n%2 == 1 {
+		sc.warn("quoted segment (%c) at index %d holds an unbalanced %c; was it meant to close the segment?",
+			q, open, other)
+	}
+}
+
+// isConfusableQuote reports whether r is easily mistaken for an ASCII quote: typographic quotes, primes,
+// modifier letters and fullwidth forms.
+func isConfusableQuote(r rune) bool {
+	switch r {
+	case '\u00b4', '\u02b9', '\u02ba', '\u02bb', '\u02bc', '\u02bd', '\u02dd', '\u05f3', '\u05f4',
+		'\u2018', '\u2019', '\u201a', '\u201b', '\u201c', '\u201d', '\u201e', '\u201f',
+		'\u2032', '\u2033', '\u2035', '\u2036', '\u301d', '\u301e', '\u301f', '\uff02', '\uff07':
+		return true
+	}
+	return false
+}
+
+// isQuote reports whether r opens a quoted segment. Quotes take precedence over splitFn, so a split
+// function that also matches a quote character never splits on it.
+func (sc *scanner) isQuote(r rune) bool {
+	switch r {
+	case '"', '\'':
+		return true
+	case '{':
+		return sc.opts.BraceQuotes
+	case '\u201c', '\u2018':
+		return sc.opts.SmartQuotes
+	}
+	return false
+}
+
+// closingQuote returns the rune closing a quoted segment opened by q.
+func closingQuote(q rune) rune {
+	switch q {
+	case '\u201c':
+		return '\u201d'
+	case '\u2018':
+		return '\u2019'
+	case '{':
+		return '}'
+	}
+	return q
+}
+
+// escape consumes the backslash at idx and what it escapes. Without DecodeEscapes the backslash is kept
+// as is and only stops a following quote from opening or closing a quoted segment; with it, the escape
+// sequence is decoded into tok. Either way an escaped backslash is consumed as a pair, so a quote is
+// escaped only by an odd number of backslashes: "ab\\" ends at its last quote. With DecodeEscapes the
+// same goes for split runes: `a\\ b` is `a\` and "b", while `a\\\ b` is the single token `a\ b`.
+func (sc *scanner) escape() error {
+	start := sc.idx
+	sc.trace(TraceEscape, start)
+	next := start + 1
+	if limit := sc.opts.MaxConsecutiveEscapes; limit > 0 && (start == 0 || sc.b[start-1] != '\\') { // a new run
+		end := next
+		for end < sc.l && sc.b[end] == '\\' {
+			end++
+		}
+		if end-start > limit {
+			return &EscapeError{Offset: start, TokenOffset: start - sc.start, Sequence: `\`,
+				Reason: fmt.Sprintf("a run of %d backslashes exceeds the maximum of %d", end-start, limit)}
+		}
+	}
+	if !sc.opts.DecodeEscapes {
+		// comparing the raw byte is safe: every byte of a multi-byte UTF-8 sequence is >= 0x80, so it
+		// can never be mistaken for an ASCII quote or backslash
+		if next < sc.l && (sc.b[next] == '"' || sc.b[next] == '\'' || sc.b[next] == '\\') { // escaped quote or backslash
+			next++
+		}
+		sc.tok = append(sc.tok, sc.b[start:next]...)
+		sc.idx = next
+		return nil
+	}
+	if next >= sc.l { // a dangling backslash stands for itself
+		sc.warn("dangling backslash at index %d taken literally", start)
+		sc.tok = append(sc.tok, '\\')
+		sc.idx = next
+		return nil
+	}
+	n := len(sc.tok)
+	if err := sc.decodeEscape(start); err != nil {
+		return err
+	}
+	// with KeepEscapes the sequence is kept as written, unless that would bring back an invalid byte
+	if sc.opts.KeepEscapes && utf8.Valid(sc.b[start:sc.idx]) {
+		sc.tok = append(sc.tok[:n], sc.b[start:sc.idx]...)
+	}
+	return nil
+}
+
+// decodeEscape decodes the escape sequence started by the backslash at index start into tok.
+func (sc *scanner) decodeEscape(start int) error {
+	next := start + 1
+	sc.idx = next
+	sc.decoded = true
+	sc.stats.Escapes++
+	r, s, err := sc.decodeRune("decode escape sequence")
+	if err != nil {
+		return err
+	}
+	sc.idx += s
+	if r == 'x' {
+		if sc.idx+2 > sc.l || !isHexDigit(sc.b[sc.idx]) || !isHexDigit(sc.b[sc.idx+1]) {
+			end := sc.idx
+			for end < sc.l && end < sc.idx+2 && isHexDigit(sc.b[end]) {
+				end++
+			}
+			return &EscapeError{Offset: start, TokenOffset: start - sc.start, Sequence: string(sc.b[start:end]),
+				Reason: `\x needs two hex digits`}
+		}
+		sc.tok = append(sc.tok, unhex(sc.b[sc.idx])<<4|unhex(sc.b[sc.idx+1]))
+		sc.idx += 2
+		return nil
+	}
+	if c, ok := simpleEscapes[r]; ok {
+		sc.tok = append(sc.tok, c)
+		return nil
+	}
+	// any other escaped rune, including quotes, backslashes and split runes, stands for itself
+	sc.idx = next
+	sc.appendRune(r, s)
+	return nil
+}
+
+// percent consumes the '%' at idx: with DecodePercent it decodes the %XX sequence it starts into tok,
+// otherwise it is an ordinary rune.
+func (sc *scanner) percent() error {
+	start := sc.idx
+	if !sc.opts.DecodePercent {
+		sc.tok = append(sc.tok, '%')
+		sc.idx++
+		return nil
+	}
+	end := start + 1
+	for end < sc.l && end < start+3 && isHexDigit(sc.b[end]) {
+		end++
+	}
+	if end != start+3 {
+		if end < sc.l && end < start+3 { // show the offending byte too
+			end++
+		}
+		return &EscapeError{Offset: start, TokenOffset: start - sc.start, Sequence: string(sc.b[start:end]),
+			Reason: "% needs two hex digits"}
+	}
+	sc.tok = append(sc.tok, unhex(sc.b[start+1])<<4|unhex(sc.b[start+2]))
+	sc.decoded = true
+	sc.stats.Escapes++
+	sc.idx = end
+	return nil
+}
+
+// simpleEscapes maps the letter of a single-letter escape sequence to the byte it stands for.
+var simpleEscapes = map[rune]byte{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', '0': 0,
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// cp1252 maps the bytes 0x80 to 0x9F of Windows-1252 to the runes they stand for; the five undefined
+// ones map to U+FFFD.
+var cp1252 = [32]rune{
+	'\u20ac', utf8.RuneError, '\u201a', '\u0192', '\u201e', '\u2026', '\u2020', '\u2021',
+	'\u02c6', '\u2030', '\u0160', '\u2039', '\u0152', utf8.RuneError, '\u017d', utf8.RuneError,
+	utf8.RuneError, '\u2018', '\u2019', '\u201c', '\u201d', '\u2022', '\u2013', '\u2014',
+	'\u02dc', '\u2122', '\u0161', '\u203a', '\u0153', utf8.RuneError, '\u017e', '\u0178',
+}
+
+// decodeCP1252 returns the rune the byte c, which is not ASCII, stands for in Windows-1252:
+// 0xA0 to 0xFF are the Latin-1 runes of the same value.
+func decodeCP1252(c byte) rune {
+	if c < 0xa0 {
+		return cp1252[c-0x80]
+	}
+	return rune(c)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+type splitCase struct {
+	in   string
+	want []string
+}
+
+// checkSplits splits each case with opts and compares the tokens.
+func checkSplits(t *testing.T, opts SplitOptions, cases []splitCase) {
+	t.Helper()
+	for _, tc := range cases {
+		got, err := ShellSplitWithOptions(tc.in, opts)
+		if err != nil {
+			t.Errorf("ShellSplitWithOptions(%q): %v", tc.in, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ShellSplitWithOptions(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMultiByteRunesNextToQuotes(t *testing.T) {
+	cases := []splitCase{
+		{`"日本"語 'ü'`, []string{"日本語", "ü"}},
+		{`é"a b"é`, []string{"éa bé"}},
+		{`"¢" '¢'`, []string{"¢", "¢"}},
+		{`a\é "\ü"`, []string{`a\é`, `\ü`}},
+	}
+	checkSplits(t, SplitOptions{}, cases)
+	checkSplits(t, SplitOptions{DecodeEscapes: true}, []splitCase{
+		{`a\é "\ü" \"é\"`, []string{"aé", "ü", `"é"`}},
+	})
+}
+
+var (
+	benchASCII     = strings.Repeat("exec /usr/local/bin/tool --verbose -o output.txt ", 40)
+	benchMultiByte = strings.Repeat("日本語 ünïcödé — «texte» ", 40)
+	benchQuoted    = strings.Repeat(`"double quoted" 'single quoted' a"b c"d "esc\"aped" `, 40)
+	benchFields    = strings.Repeat("a b c d e f g h ", 100)
+)
+
+func benchmarkSplit(b *testing.B, s string) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(s)))
+	for i := 0; i < b.N; i++ {
+		if _, err := ShellSplitEx(s, unicode.IsSpace); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSplitASCII(b *testing.B)      { benchmarkSplit(b, benchASCII) }
+func BenchmarkSplitMultiByte(b *testing.B)  { benchmarkSplit(b, benchMultiByte) }
+func BenchmarkSplitQuoted(b *testing.B)     { benchmarkSplit(b, benchQuoted) }
+func BenchmarkSplitManyFields(b *testing.B) { benchmarkSplit(b, benchFields) }
+
+func TestSplitAllocs(t *testing.T) {
+	s := strings.Repeat(`word "quoted token" `, 50)
+	allocs := testing.AllocsPerRun(100, func() {
+		ShellSplitEx(s, unicode.IsSpace)
+	})
+	// one string per token, plus the input copy, the scanner, the result and the token buffer
+	if limit := float64(100 + 8); allocs > limit {
+		t.Errorf("ShellSplitEx of 100 tokens makes %v allocations, want at most %v", allocs, limit)
+	}
+}
+
+func TestLoneQuote(t *testing.T) {
+	for _, q := range []string{`"`, `'`} {
+		_, err := ShellSplit(q)
+		var uqe *UnterminatedQuoteError
+		if !errors.As(err, &uqe) || uqe.Offset != 0 {
+			t.Errorf("ShellSplit(%s): got %v, want an UnterminatedQuoteError at offset 0", q, err)
+		} else if !strings.Contains(err.Error(), "starting at index 0") {
+			t.Errorf("ShellSplit(%s): error %q does not name index 0", q, err)
+		}
+	}
+	checkSplits(t, SplitOptions{LenientQuotes: true}, []splitCase{
+		{`"`, []string{`"`}},
+		{`'`, []string{`'`}},
+	})
+}
+
+func TestFallbackCP1252Quotes(t *testing.T) {
+	checkSplits(t, SplitOptions{FallbackCP1252: true}, []splitCase{
+		{"\x93hi\x94 x", []string{"“hi”", "x"}},
+	})
+	checkSplits(t, SplitOptions{FallbackCP1252: true, SmartQuotes: true}, []splitCase{
+		{"\x93a b\x94 c", []string{"a b", "c"}},
+		{"\x93\x94", []string{""}},
+		{"\x91a\x92 “b\x94 \x93c”", []string{"a", "b", "c"}}, // mixed encodings of the quotes
+	})
+	for _, opts := range []SplitOptions{
+		{FallbackCP1252: true, SmartQuotes: true, QuotePolicy: POSIXQuotePolicy{}},
+		{FallbackCP1252: true, SmartQuotes: true, QuotePolicy: RawQuotePolicy{}},
+		{FallbackCP1252: true, SmartQuotes: true, WarnQuoteMismatch: true, TraceFunc: func(string, int) {}},
+	} {
+		for _, s := range []string{"\x93\x94", "\x93ab\x94", "“ab\x94", "\x93ab”", "\x91a\x92 \x93\x91\x94"} {
+			if _, err := ShellSplitWithOptions(s, opts); err != nil {
+				t.Errorf("ShellSplitWithOptions(%q): %v", s, err)
+			}
+			if _, err := ShellSplitTokens(s, opts); err != nil {
+				t.Errorf("ShellSplitTokens(%q): %v", s, err)
+			}
+		}
+	}
+	got, err := ShellSplitWithOptions("\x93ab\x94", SplitOptions{FallbackCP1252: true, SmartQuotes: true,
+		QuotePolicy: RawQuotePolicy{}})
+	if want := []string{"“ab”"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("RawQuotePolicy split = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestStrayQuote(t *testing.T) {
+	// the first quote always opens a quoted segment, so a stray one is reported as left open
+	_, err := ShellSplit(`a b" c`)
+	var uqe *UnterminatedQuoteError
+	if !errors.As(err, &uqe) || uqe.Offset != 3 || uqe.Quote != '"' {
+		t.Fatalf(`ShellSplit("a b\" c"): got %v, want an UnterminatedQuoteError for " at offset 3`, err)
+	}
+	if !strings.Contains(err.Error(), "starting at index 3") {
+		t.Errorf("error %q does not name index 3", err)
+	}
+	checkSplits(t, SplitOptions{LenientQuotes: true}, []splitCase{
+		{`a b" c`, []string{"a", `b"`, "c"}},
+	})
+}
+
+func TestEscapedBackslashBeforeSpace(t *testing.T) {
+	checkSplits(t, SplitOptions{DecodeEscapes: true}, []splitCase{
+		{`a\\ b`, []string{`a\`, "b"}},
+		{`a\\\ b`, []string{`a\ b`}},
+		{`a\\\\ b`, []string{`a\\`, "b"}},
+	})
+}
+
+func TestBackslashAfterOpeningQuote(t *testing.T) {
+	tokens, err := ShellSplitTokens(`"\\abc"`, SplitOptions{DecodeEscapes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Value != `\abc` || tokens[0].Raw != `"\\abc"` {
+		t.Errorf(`ShellSplitTokens("\\abc") = %+v, want the value \abc from the raw "\\abc"`, tokens)
+	}
+}
+
+func TestTraceFunc(t *testing.T) {
+	type event struct {
+		name string
+		pos  int
+	}
+	var got []event
+	opts := SplitOptions{TraceFunc: func(name string, pos int) { got = append(got, event{name, pos}) }}
+	if _, err := ShellSplitWithOptions(`a "b\"c" d`, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []event{
+		{TraceToken, 0},
+		{TraceQuoteOpen, 2}, {TraceEscape, 4}, {TraceQuoteClose, 7}, {TraceToken, 2},
+		{TraceToken, 9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trace = %v, want %v", got, want)
+	}
+}
+
+func TestEscapedQuotesOutsideQuotes(t *testing.T) {
+	checkSplits(t, SplitOptions{DecodeEscapes: true}, []splitCase{
+		{`\"quoted\"`, []string{`"quoted"`}},
+		{`\'x\' \"a b\"`, []string{`'x'`, `"a`, `b"`}},
+	})
+	checkSplits(t, SplitOptions{}, []splitCase{
+		{`\"quoted\"`, []string{`\"quoted\"`}}, // without DecodeEscapes the backslashes are kept
+	})
+}
+
+func TestBraceQuotes(t *testing.T) {
+	opts := SplitOptions{BraceQuotes: true}
+	checkSplits(t, opts, []splitCase{
+		{`{a {b c} d}`, []string{"a {b c} d"}}, // only the outermost pair is removed
+		{"{a\\\n   b} c", []string{"a b", "c"}},
+		{`a{b c} {x\}y}`, []string{"a{b", "c}", `x\}y`}},
+	})
+	var uqe *UnterminatedQuoteError
+	if _, err := ShellSplitWithOptions(`x {a {b} c`, opts); !errors.As(err, &uqe) || uqe.Offset != 2 {
+		t.Errorf(`ShellSplitWithOptions("x {a {b} c") error = %v, want an UnterminatedQuoteError at 2`, err)
+	}
+	opts.LenientQuotes = true
+	checkSplits(t, opts, []splitCase{
+		{`{a {b} c`, []string{"{a", "b", "c"}},
+		{`{ {a} { {b`, []string{"{", "a", "{", "{b"}},
+	})
+}
+
+// TestLenientQuotesLinear would take seconds if every unclosed quote scanned to the end of the input.
+func TestLenientQuotesLinear(t *testing.T) {
+	for _, tc := range []struct {
+		opts  SplitOptions
+		unit  string
+		count int // tokens per unit
+	}{
+		{SplitOptions{BraceQuotes: true, LenientQuotes: true}, "{ ", 1},
+		{SplitOptions{BraceQuotes: true, LenientQuotes: true}, "{ {a} ", 2},
+		{SplitOptions{SmartQuotes: true, LenientQuotes: true}, "“ ", 1},
+	} {
+		got, err := ShellSplitWithOptions(strings.Repeat(tc.unit, 20000), tc.opts)
+		if err != nil || len(got) != 20000*tc.count {
+			t.Errorf("%d × %q: %d tokens, %v; want %d", 20000, tc.unit, len(got), err, 20000*tc.count)
+		}
+	}
+}
+
+func TestSmartQuotes(t *testing.T) {
+	opts := SplitOptions{SmartQuotes: true}
+	checkSplits(t, opts, []splitCase{
+		{`“a b” ‘c d’ "e f" 'g h'`, []string{"a b", "c d", "e f", "g h"}},
+		{`“it's” ‘say "hi"’`, []string{"it's", `say "hi"`}},
+	})
+	opts.LenientQuotes = true
+	checkSplits(t, opts, []splitCase{
+		{`“a “b” c`, []string{"a “b", "c"}},
+		{`“a “b ‘c’ d`, []string{"“a", "“b", "c", "d"}},
+	})
+}
+
+func TestQuotedEmptySegments(t *testing.T) {
+	checkSplits(t, SplitOptions{}, []splitCase{
+		{`a""b`, []string{"ab"}},
+		{`x''y`, []string{"xy"}},
+		{`"" ''`, []string{"", ""}},
+	})
+}
+
+func TestTrailingEscapedBackslash(t *testing.T) {
+	checkSplits(t, SplitOptions{}, []splitCase{ // without DecodeEscapes, escaped backslashes are kept
+		{`"ab\\"`, []string{`ab\\`}},
+		{`"ab\\\""`, []string{`ab\\\"`}},
+	})
+	checkSplits(t, SplitOptions{DecodeEscapes: true}, []splitCase{
+		{`"ab\\"`, []string{`ab\`}},
+		{`"ab\\\""`, []string{`ab\"`}},
+	})
+}
+
+func TestQuoteMidToken(t *testing.T) {
+	var uqe *UnterminatedQuoteError
+	if _, err := ShellSplit(`it's here`); !errors.As(err, &uqe) || uqe.Offset != 2 {
+		t.Errorf(`ShellSplit("it's here") error = %v, want an UnterminatedQuoteError at 2`, err)
+	}
+	checkSplits(t, SplitOptions{LenientQuotes: true}, []splitCase{{`it's here`, []string{"it's", "here"}}})
+}
+
+func TestSplitFnMatchingQuote(t *testing.T) {
+	// a quote is a quote even if SplitFn matches it too
+	splitFn := func(r rune) bool { return r == '\'' || unicode.IsSpace(r) }
+	checkSplits(t, SplitOptions{SplitFn: splitFn}, []splitCase{{`a'b c' d`, []string{"ab c", "d"}}})
+}
+
+func TestEscapedQuoteInDoubleQuotesOnly(t *testing.T) {
+	checkSplits(t, SplitOptions{}, []splitCase{{`"a\"b"`, []string{`a\"b`}}})
+	checkSplits(t, SplitOptions{DecodeEscapes: true}, []splitCase{{`"a\"b"`, []string{`a"b`}}})
+	// the backslash is literal in single quotes, so the quote after it closes them and the last one opens
+	// a quoted segment that is never closed
+	var uqe *UnterminatedQuoteError
+	if _, err := ShellSplit(`'a\'b'`); !errors.As(err, &uqe) || uqe.Offset != 5 {
+		t.Errorf(`ShellSplit("'a\\'b'") error = %v, want an UnterminatedQuoteError at 5`, err)
+	}
+}
+
+func TestMaxConsecutiveEscapes(t *testing.T) {
+	opts := SplitOptions{MaxConsecutiveEscapes: 4}
+	checkSplits(t, opts, []splitCase{
+		{`a\\\\b`, []string{`a\\\\b`}},
+		{`'\\\\\\'`, []string{`\\\\\\`}}, // single quotes are literal
+	})
+	var ee *EscapeError
+	if _, err := ShellSplitWithOptions(`a\\\\\b`, opts); !errors.As(err, &ee) || ee.Offset != 1 {
+		t.Errorf("5 backslashes: error = %v, want an EscapeError at 1", err)
+	}
+}
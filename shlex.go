@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// shlexSpace is the whitespace of Python's shlex module.
+const shlexSpace = " \t\r\n"
+
+// ShlexSplit splits s like Python's shlex.split(s, comments, posix), for code ported from Python.
+// With comments, a '#' outside quotes starts a comment that runs to the end of the line.
+//
+// With posix, quotes are removed and concatenated with their neighbors, a backslash outside quotes
+// escapes any rune, inside double quotes it only escapes '"' and '\', and single quotes are literal:
+// `a"b c"d 'e\f' g\ h` is "ab cd", `e\f` and "g h". Without it, there are no escapes, a quote only opens
+// a quoted segment at the start of a token and is kept, and a quoted segment ends its token:
+// `"a b"c d"e` is `"a b"`, "c" and `d"e`. A quote left open is an UnterminatedQuoteError, and so is
+// a backslash ending the input (in posix mode), as an EscapeError.
+//
+// shlex's escape rules differ from those SplitOptions can express (\n is an escaped 'n', not a newline),
+// so ShlexSplit has its own scanner, which follows the state machine of CPython's shlex.
+func ShlexSplit(s string, comments bool, posix bool) ([]string, error) {
+	fields := make([]string, 0)
+	var tok strings.Builder
+	inToken, quoted := false, false // a token is being built; it has a quoted segment (posix)
+	start := 0                      // index of the current token
+	emit := func() {
+		if inToken || quoted {
+			fields = append(fields, tok.String())
+		}
+		tok.Reset()
+		inToken, quoted = false, false
+	}
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case strings.ContainsRune(shlexSpace, r):
+			emit()
+			i += n
+			start = i
+		case r == '#' && comments:
+			if eol := strings.IndexByte(s[i:], '\n'); eol >= 0 {
+				i += eol + 1
+			} else {
+				i = len(s)
+			}
+			if posix { // a comment ends the token; in non-posix mode shlex carries on with the next line
+				emit()
+				start = i
+			}
+		case r == '\\' && posix:
+			if i+n == len(s) {
+				return nil, WrapTraceableErrorf(&EscapeError{Offset: i, TokenOffset: i - start, Sequence: `\`,
+					Reason: "no escaped character"}, "failed to shlex-split %q", s)
+			}
+			_, m := utf8.DecodeRuneInString(s[i+n:])
+			tok.WriteString(s[i+n : i+n+m])
+			inToken = true
+			i += n + m
+		case (r == '"' || r == '\'') && (posix || !inToken):
+			end, err := shlexQuote(&tok, s, i, posix)
+			if err != nil {
+				return nil, WrapTraceableErrorf(err, "failed to shlex-split %q", s)
+			}
+			i = end
+			if posix {
+				quoted = true
+			} else { // the quoted segment is the whole token
+				inToken = true
+				emit()
+				start = i
+			}
+		default:
+			tok.WriteString(s[i : i+n])
+			inToken = true
+			i += n
+		}
+	}
+	emit()
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// shlexQuote writes the quoted segment of s opened at index open to tok and returns the index after it.
+// In posix mode the quotes are dropped and a backslash in double quotes escapes '"' and '\'.
+func shlexQuote(tok *strings.Builder, s string, open int, posix bool) (int, error) {
+	q := s[open]
+	if !posix {
+		tok.WriteByte(q)
+	}
+	for i := open + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == q:
+			if !posix {
+				tok.WriteByte(q)
+			}
+			return i + 1, nil
+		case c == '\\' && q == '"' && posix && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			tok.WriteByte(s[i])
+		default:
+			tok.WriteByte(c)
+		}
+	}
+	return 0, &UnterminatedQuoteError{Offset: open, Quote: rune(q)}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestShlexSplit checks ShlexSplit against what Python's shlex.split returns for the same arguments.
+func TestShlexSplit(t *testing.T) {
+	for _, tc := range []struct {
+		in              string
+		comments, posix bool
+		want            []string // nil for a ValueError
+	}{
+		{`a "b c" d`, false, true, []string{"a", "b c", "d"}},
+		{`a'b c'd`, false, true, []string{"ab cd"}},
+		{`a"b\"c"d`, false, true, []string{`ab"cd`}},
+		{`'e\f' g\ h`, false, true, []string{`e\f`, "g h"}},
+		{`"a\nb"`, false, true, []string{`a\nb`}},
+		{`"a b"c d"e`, false, false, []string{`"a b"`, "c", `d"e`}},
+		{`a # b`, false, true, []string{"a", "#", "b"}},
+		{`a # b`, true, true, []string{"a"}},
+		{"a #b\nc", true, true, []string{"a", "c"}},
+		{`"a`, false, true, nil}, // No closing quotation
+		{`a\`, false, true, nil}, // No escaped character
+	} {
+		got, err := ShlexSplit(tc.in, tc.comments, tc.posix)
+		if (err != nil) != (tc.want == nil) || !reflect.DeepEqual(got, tc.want) && tc.want != nil {
+			t.Errorf("ShlexSplit(%q, %v, %v) = %q, %v; want %q", tc.in, tc.comments, tc.posix, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Splitter splits strings with a fixed set of SplitOptions. It is safe for concurrent use: after
+// NewSplitter it only holds a copy of the options, which splitting never modifies (the scanner state,
+// CacheASCII table included, is per call), and a sync.Pool. The functions in the options, such as
+// SplitFn and TokenFunc, are then called from several goroutines at once and must allow it.
+type Splitter struct {
+	opts SplitOptions
+	pool sync.Pool // of *Fields
+}
+
+// NewSplitter returns a Splitter that splits as configured by opts.
+func NewSplitter(opts SplitOptions) *Splitter {
+	sp := &Splitter{opts: opts}
+	sp.pool.New = func() interface{} { return &Fields{sp: sp} }
+	return sp
+}
+
+// Split splits s like ShellSplitWithOptions with the Splitter's options.
+func (sp *Splitter) Split(s string) ([]string, error) {
+	return splitBytes([]byte(s), &sp.opts)
+}
+
+// Fields holds the tokens returned by Splitter.SplitPooled.
+//
+// Ownership: the Tokens slice belongs to the Splitter's pool. It is only valid until Release is called,
+// after which it is reused by another call and must not be read, written or retained. The strings in
+// it are ordinary immutable strings and may be kept; copy the slice itself if it must outlive Release.
+type Fields struct {
+	Tokens []string
+	sc     scanner // kept for reuse, token buffer included
+	sp     *Splitter
+}
+
+// Release returns f to the pool of the Splitter that produced it. f must not be used afterwards.
+func (f *Fields) Release() {
+	for i := range f.Tokens {
+		f.Tokens[i] = "" // don't keep the strings alive from the pool
+	}
+	f.Tokens = f.Tokens[:0]
+	f.sc.reset(nil, &f.sp.opts) // don't keep the input alive from the pool
+	f.sp.pool.Put(f)
+}
+
+// SplitPooled splits s like Split but takes the token slice and the scanner from a pool, so that a
+// server splitting many inputs reuses the same few of them instead of allocating new ones per call. It
+// scans s in place, and a token spelled in s exactly as it comes out, such as any token without quotes,
+// is a substring of s, so in the steady state only tokens changed by quote removal allocate. The caller
+// must call Release on the result once done with it (see Fields for the ownership contract); on error
+// nothing needs to be released.
+func (sp *Splitter) SplitPooled(s string) (*Fields, error) {
+	f := sp.pool.Get().(*Fields)
+	sc := &f.sc
+	sc.reset(unsafe.Slice(unsafe.StringData(s), len(s)), &sp.opts) // the scanner never writes to its input
+	sc.src = s
+	for {
+		start, ok, err := sc.next()
+		if err != nil {
+			f.Release()
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		value, err := sc.value(start)
+		if err != nil {
+			f.Release()
+			return nil, err
+		}
+		f.Tokens = append(f.Tokens, value)
+	}
+	if len(f.Tokens) == 0 && sp.opts.DefaultToken != "" {
+		f.Tokens = append(f.Tokens, sp.opts.DefaultToken)
+	}
+	return f, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSplitPooledReuse(t *testing.T) {
+	sp := NewSplitter(SplitOptions{})
+	var kept []string
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{`a "b c" d`, []string{"a", "b c", "d"}},
+		{`x`, []string{"x"}},
+		{``, nil},
+		{`one two three four five`, []string{"one", "two", "three", "four", "five"}},
+		{`'q' r`, []string{"q", "r"}},
+	} {
+		f, err := sp.SplitPooled(tc.in)
+		if err != nil {
+			t.Fatalf("SplitPooled(%q): %v", tc.in, err)
+		}
+		if got := append([]string(nil), f.Tokens...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SplitPooled(%q) = %q, want %q", tc.in, f.Tokens, tc.want)
+		}
+		kept = append(kept, f.Tokens...)
+		f.Release()
+	}
+	// the strings outlive Release
+	want := []string{"a", "b c", "d", "x", "one", "two", "three", "four", "five", "q", "r"}
+	if !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept tokens = %q, want %q", kept, want)
+	}
+	if _, err := sp.SplitPooled(`a "b`); err == nil {
+		t.Error(`SplitPooled("a \"b") succeeded; want an error`)
+	}
+}
+
+// raceEnabled is set by race_test.go: the race detector makes sync.Pool drop items at random.
+var raceEnabled bool
+
+func TestSplitPooledAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool does not keep every item under the race detector")
+	}
+	sp := NewSplitter(SplitOptions{})
+	input := "exec /usr/local/bin/tool -v --name=value"
+	sp.SplitPooled(input) // warm up the pool
+	allocs := testing.AllocsPerRun(100, func() {
+		f, err := sp.SplitPooled(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Release()
+	})
+	if allocs != 0 {
+		t.Errorf("SplitPooled makes %v allocations per call in the steady state, want 0", allocs)
+	}
+}
+
+var splitterInput = `exec --name="some value" /usr/local/bin/tool -v -x 'arg two' last`
+
+func BenchmarkSplitterSplit(b *testing.B) {
+	sp := NewSplitter(SplitOptions{})
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := sp.Split(splitterInput); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSplitterSplitPooled(b *testing.B) {
+	sp := NewSplitter(SplitOptions{})
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			f, err := sp.SplitPooled(splitterInput)
+			if err != nil {
+				b.Fatal(err)
+			}
+			f.Release()
+		}
+	})
+}
+
+// TestSplitterConcurrentUse is meant for go test -race: a Splitter is shared by many goroutines.
+func TestSplitterConcurrentUse(t *testing.T) {
+	sp := NewSplitter(SplitOptions{CacheASCII: true, DecodeEscapes: true})
+	want := []string{"exec", "--name=some value", "/usr/local/bin/tool", "-v", "-x", "arg two", "last"}
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				got, err := sp.Split(splitterInput)
+				if err != nil || !reflect.DeepEqual(got, want) {
+					t.Errorf("Split = %q, %v; want %q", got, err, want)
+					return
+				}
+				f, err := sp.SplitPooled(splitterInput)
+				if err != nil {
+					t.Errorf("SplitPooled: %v", err)
+					return
+				}
+				if !reflect.DeepEqual(f.Tokens, want) {
+					t.Errorf("SplitPooled = %q, want %q", f.Tokens, want)
+				}
+				f.Release()
+			}
+		}()
+	}
+	wg.Wait()
+}
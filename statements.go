@@ -0,0 +1,110 @@
+package main
+
+import "strings"
+
+// StatementOptions controls how ShellSplitStatements splits its input.
+type StatementOptions struct {
+	// RejectEmpty makes an empty statement around an operator an error, as in `&& b`, `a ;; b` or
+	// `a &&`, which usually means a command is missing. A trailing ';' is still allowed. Otherwise
+	// empty statements are dropped.
+	RejectEmpty bool
+}
+
+// statement is the source text of one statement and the operator ending it.
+type statement struct {
+	text  string
+	start int    // byte index of text in the input
+	op    string // ";", "&&", "||", or "" for the last statement
+}
+
+// ShellSplitStatements splits the command line s into statements at the operators ';', "&&" and "||"
+// outside quotes, and each statement into tokens like ShellSplit: `a b && c; d` is ["a" "b"], ["c"]
+// and ["d"]. A single '&' or '|' is part of a token.
+func ShellSplitStatements(s string, opts StatementOptions) ([][]string, error) {
+	statements, err := splitStatements(s, opts)
+	if err != nil {
+		return nil, err
+	}
+	var fields [][]string
+	for i, st := range statements {
+		f, err := ShellSplit(st.text)
+		if err != nil {
+			rebaseError(err, st.start)
+			return nil, WrapTraceableErrorf(err, "failed to split statement %d at index %d", i, st.start)
+		}
+		if f != nil {
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// ShellSplitStatementsEach splits s like ShellSplitStatements but carries on past a statement that fails
+// to split, returning the error of each statement in errs, index-aligned with fields: errs[i] is nil if
+// fields[i] was split, and fields[i] is nil otherwise. If s cannot be cut into statements at all (with
+// RejectEmpty), the error is the only one, for a single nil statement.
+func ShellSplitStatementsEach(s string, opts StatementOptions) (fields [][]string, errs []error) {
+	statements, err := splitStatements(s, opts)
+	if err != nil {
+		return [][]string{nil}, []error{err}
+	}
+	for i, st := range statements {
+		f, err := ShellSplit(st.text)
+		if err != nil {
+			rebaseError(err, st.start)
+			err = WrapTraceableErrorf(err, "failed to split statement %d at index %d", i, st.start)
+		} else if f == nil {
+			continue
+		}
+		fields, errs = append(fields, f), append(errs, err)
+	}
+	return fields, errs
+}
+
+// splitStatements cuts s at its operators, checking for empty statements if opts says so. Quotes are
+// tracked like scanQuotes does, so an operator in quotes or escaped with a backslash is not one.
+func splitStatements(s string, opts StatementOptions) ([]statement, error) {
+	var statements []statement
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		op := ""
+		switch c := s[i]; {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			op = ";"
+		case (c == '&' || c == '|') && i+1 < len(s) && s[i+1] == c:
+			op = s[i : i+2]
+		}
+		if op == "" {
+			continue
+		}
+		st := statement{text: s[start:i], start: start, op: op}
+		if opts.RejectEmpty && isBlank(st.text) {
+			return nil, WrapTraceableErrorf(nil, "failed to split statements: missing statement before %q at index %d", op, i)
+		}
+		statements = append(statements, st)
+		i += len(op) - 1
+		start = i + 1
+	}
+	last := statement{text: s[start:], start: start}
+	if opts.RejectEmpty && isBlank(last.text) && len(statements) > 0 {
+		if op := statements[len(statements)-1].op; op != ";" {
+			return nil, WrapTraceableErrorf(nil, "failed to split statements: missing statement after %q at index %d",
+				op, start-len(op))
+		}
+	}
+	return append(statements, last), nil
+}
+
+// isBlank reports whether s holds nothing but whitespace.
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellSplitStatementsErrorOffset(t *testing.T) {
+	input := `echo ok; ls "x`
+	_, err := ShellSplitStatements(input, StatementOptions{})
+	var uqe *UnterminatedQuoteError
+	if !errors.As(err, &uqe) || uqe.Offset != 12 {
+		t.Fatalf("ShellSplitStatements(%q) error = %v, want an UnterminatedQuoteError at 12", input, err)
+	}
+	if got, want := FormatError(err, input), input+"\n"+strings.Repeat(" ", 12)+"^"; !strings.HasSuffix(got, want) {
+		t.Errorf("FormatError = %q, want it to end with %q", got, want)
+	}
+}
+
+func TestRejectEmpty(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		reject bool
+		want   [][]string // nil for an error
+	}{
+		{"a && ", true, nil},
+		{"&& b", true, nil},
+		{"a ;; b", true, nil},
+		{"a;", true, [][]string{{"a"}}}, // a trailing ';' is still allowed
+		{"a && ", false, [][]string{{"a"}}},
+		{"&& b", false, [][]string{{"b"}}},
+	} {
+		got, err := ShellSplitStatements(tc.in, StatementOptions{RejectEmpty: tc.reject})
+		if (err != nil) != (tc.want == nil) || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ShellSplitStatements(%q, RejectEmpty: %v) = %q, %v; want %q", tc.in, tc.reject, got, err, tc.want)
+		}
+	}
+}
+
+func TestShellSplitStatementsEach(t *testing.T) {
+	input := `echo ok; ls "x`
+	fields, errs := ShellSplitStatementsEach(input, StatementOptions{})
+	if want := [][]string{{"echo", "ok"}, nil}; !reflect.DeepEqual(fields, want) || len(errs) != len(want) {
+		t.Fatalf("ShellSplitStatementsEach(%q) = %q, %v; want %q and an error for each", input, fields, errs, want)
+	}
+	var uqe *UnterminatedQuoteError
+	if errs[0] != nil || !errors.As(errs[1], &uqe) || uqe.Offset != 12 {
+		t.Errorf("errors = %v; want nil, then an UnterminatedQuoteError at 12", errs)
+	}
+}
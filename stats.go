@@ -0,0 +1,20 @@
+package main
+
+// Stats counts the work SplitWithStats did on its input.
+type Stats struct {
+	QuotedRegions int // quoted segments, including empty ones
+	Escapes       int // escape and percent sequences decoded
+	Tokens        int // tokens produced
+}
+
+// SplitWithStats splits s like ShellSplitWithOptions and also reports how many quoted segments and
+// escape sequences it went through, e.g. to find out which inputs are expensive to split.
+func SplitWithStats(s string, opts SplitOptions) ([]string, Stats, error) {
+	sc := newScanner([]byte(s), &opts)
+	fields, err := sc.split()
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	sc.stats.Tokens = len(fields)
+	return fields, sc.stats, nil
+}
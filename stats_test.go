@@ -0,0 +1,16 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWithStats(t *testing.T) {
+	fields, stats, err := SplitWithStats(`a "b\"c" 'd' e\ f ""`, SplitOptions{DecodeEscapes: true})
+	if want := []string{"a", `b"c`, "d", "e f", ""}; err != nil || !reflect.DeepEqual(fields, want) {
+		t.Fatalf("SplitWithStats = %q, %v; want %q", fields, err, want)
+	}
+	if want := (Stats{QuotedRegions: 3, Escapes: 2, Tokens: 5}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import "strings"
+
+// WindowsOptions controls how SplitWindowsCommandLine splits its input.
+// The zero value splits like CommandLineToArgvW.
+type WindowsOptions struct {
+	// CaretEscape adds the escaping of cmd.exe: outside double quotes, '^' makes the rune after it
+	// literal and is removed, so `a^ b` is "a b" and `^"x^"` is `"x"`. Inside double quotes it is an
+	// ordinary rune, and so is a '^' ending the input.
+	CaretEscape bool
+}
+
+// SplitWindowsCommandLine splits s into the argv a Windows program receives from the C runtime
+// (the rules of CommandLineToArgvW): arguments are separated by spaces and tabs outside double quotes,
+// double quotes group and are removed, 2n backslashes before a '"' stand for n backslashes and 2n+1 for
+// n backslashes and a literal '"', and other backslashes are literal, so `C:\dir\ "a \"b\""` is
+// `C:\dir\` and `a "b"`. Inside double quotes, "" is a literal '"'. A quote left open runs to the end
+// of s, as on Windows. Unlike ShellSplit, single quotes are ordinary runes.
+func SplitWindowsCommandLine(s string, opts WindowsOptions) []string {
+	args := make([]string, 0)
+	var arg strings.Builder
+	inArg, inQuotes := false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '\\':
+			n := 1
+			for i+n < len(s) && s[i+n] == '\\' {
+				n++
+			}
+			if i+n < len(s) && s[i+n] == '"' {
+				arg.WriteString(strings.Repeat(`\`, n/2))
+				if n%2 == 1 { // an escaped quote
+					arg.WriteByte('"')
+					i++
+				}
+			} else {
+				arg.WriteString(s[i : i+n])
+			}
+			i += n - 1
+			inArg = true
+		case c == '"':
+			if inQuotes && i+1 < len(s) && s[i+1] == '"' { // "" in quotes is a literal quote
+				arg.WriteByte('"')
+				i++
+			} else {
+				inQuotes = !inQuotes
+			}
+			inArg = true
+		case c == '^' && opts.CaretEscape && !inQuotes && i+1 < len(s):
+			i++
+			arg.WriteByte(s[i])
+			inArg = true
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// SplitBothDialects splits s both as a POSIX shell would, with ShlexSplit in posix mode, and as a
+// Windows program would, with SplitWindowsCommandLine, so cross-platform tools can warn when the two
+// disagree (`C:\dir\ a` is "C:dir a" for POSIX, but `C:\dir\` and "a" on Windows). Only the POSIX split
+// can fail.
+func SplitBothDialects(s string) (posix []string, windows []string, err error) {
+	if posix, err = ShlexSplit(s, false, true); err != nil {
+		return nil, nil, WrapTraceableErrorf(err, "failed to split %q as POSIX", s)
+	}
+	return posix, SplitWindowsCommandLine(s, WindowsOptions{}), nil
+}
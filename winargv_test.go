@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCaretEscape(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		caret bool
+		want  []string
+	}{
+		{`echo ^"quoted^"`, true, []string{"echo", `"quoted"`}},
+		{`a^ b`, true, []string{"a b"}},
+		{`a^^b`, true, []string{"a^b"}},
+		{`a^ b`, false, []string{"a^", "b"}},
+	} {
+		if got := SplitWindowsCommandLine(tc.in, WindowsOptions{CaretEscape: tc.caret}); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SplitWindowsCommandLine(%q, CaretEscape: %v) = %q, want %q", tc.in, tc.caret, got, tc.want)
+		}
+	}
+}
+
+func TestSplitBothDialects(t *testing.T) {
+	posix, windows, err := SplitBothDialects(`'a b' c\d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a b", "cd"}; !reflect.DeepEqual(posix, want) {
+		t.Errorf("posix = %q, want %q", posix, want)
+	}
+	if want := []string{"'a", "b'", `c\d`}; !reflect.DeepEqual(windows, want) {
+		t.Errorf("windows = %q, want %q", windows, want)
+	}
+}